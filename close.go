@@ -0,0 +1,57 @@
+package log
+
+// Close logger, tearing down sender daemon and sinks.
+
+import (
+	"context"
+)
+
+// Close closes default logger.
+func Close(ctx context.Context) error {
+	return std.Close(ctx)
+}
+
+// Close stops capturing stdout and stderr, flushes logs, and then stops
+// sending logs to edge, closing the edge connection, spool and all sinks.
+// It waits till then or till context is done, returning the first error.
+// Logs not delivered by then are spooled if spool is set, else dropped.
+// Logs published after close are printed to stdout only. The logger may be
+// set up again afterwards, such as with SetAPIKey and AddSink. If sender
+// daemon did not stop in time, SetAPIKey waits for it to stop first.
+func (l *Logger) Close(ctx context.Context) error {
+
+	// publish captured output, and restore stdout and stderr
+	firstErr := l.stopCaptures(ctx)
+
+	// deliver what we can
+	if err := l.FlushContext(ctx); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	// stop pushing logs to edge, and stop sender daemon
+	l.conf.apiKey.Store("")
+	if err := l.stopSender(ctx); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	// close spool, keeping spooled logs on disk for next start
+	if err := l.SetSpool("", 0); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	// close sinks, leaving default ones in place
+	l.sinksMu.Lock()
+	sinks := l.sinks
+	l.sinks = []Sink{l.stdoutSink, l.edgeSink}
+	l.sinksMu.Unlock()
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			l.internalError(&InternalError{Stage: StageSink, Err: err})
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
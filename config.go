@@ -1,20 +1,39 @@
 package log
 
 import (
-	"fmt"
+	"sync/atomic"
+	"time"
 
+	"github.com/blitzlog/errors"
 	"github.com/blitzlog/proto/log"
 )
 
 type config struct {
-	logLevel     log.Level // current log type
-	logVerbosity int32     // current log level
-	logJson      bool      // log as json
-	logLocal     bool      // log to stdout
-	apiKey       string    // API Key
-	apiError     bool      // API Key is incorrect
-	edgeAddress  string    // edge address
-	edgeCert     string    // certificate to authenticate edge
+	logLevel     log.Level    // current log type
+	logVerbosity int32        // current log level
+	logFormat    string       // local format, text or console by default
+	json         atomic.Value // *JSONEncoder, nil for default keys
+	console      atomic.Value // *ConsoleEncoder, set by Console
+	formatter    atomic.Value // formatterValue, overrides local format
+	tagOrder     TagOrder     // order of tags in formatted logs
+	logLocal     bool         // log to stdout
+	apiKey       atomic.Value // string, API key, empty once closed
+	apiError     bool         // API Key is incorrect
+	edgeAddress  string       // edge address
+	edgeCert     string       // certificate to authenticate edge
+	overflow     Overflow     // policy when edge channel is full
+	panicMode    PanicMode    // what to do after logging a panic
+
+	backoff          Backoff       // delay between retries to edge
+	breakerThreshold int           // failures to open circuit breaker
+	breakerCooldown  time.Duration // circuit breaker open time
+	clock            Clock         // clock to time retries
+
+	sampleFirst      int           // logs published per call site per interval
+	sampleThereafter int           // then publish every nth log
+	sampleInterval   time.Duration // sampling interval
+	rateLimit        float64       // logs per second, for all call sites
+	rateBurst        int           // burst of logs over rate limit
 }
 
 func defaultConfig() *config {
@@ -22,12 +41,30 @@ func defaultConfig() *config {
 		edgeAddress: defaultEdgeAddress,
 		edgeCert:    defaultEdgeCert,
 		logLocal:    true,
+
+		backoff:          DefaultBackoff(),
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+		clock:            systemClock{},
 	}
 }
 
+// getAPIKey returns API key, empty if not set.
+func (l *Logger) getAPIKey() string {
+	key, _ := l.conf.apiKey.Load().(string)
+	return key
+}
+
+// SetAPIKey sets API key of default logger, and starts sending logs to edge.
 func SetAPIKey(key string, args ...string) {
+	std.SetAPIKey(key, args...)
+}
+
+// SetAPIKey sets API key, and starts sending logs to edge.
+func (l *Logger) SetAPIKey(key string, args ...string) {
 	// set api key
-	l.conf.apiKey = key
+	l.conf.apiKey.Store(key)
+	l.conf.apiError = false
 
 	// second arg is edge address
 	if len(args) >= 1 {
@@ -40,28 +77,28 @@ func SetAPIKey(key string, args ...string) {
 	}
 
 	// send logs to edge
-	sender()
+	l.sender()
 }
 
 func JSON() {
-	l.conf.logJson = true
+	std.JSON()
+}
+
+func (l *Logger) JSON() {
+	l.setLocalFormat(FormatJSON)
 }
 
 func Local() {
+	std.Local()
+}
+
+func (l *Logger) Local() {
 	l.conf.logLocal = true
 }
 
+// String encodes a tag value, as encoded by Any.
 func String(i interface{}) string {
-	switch v := i.(type) {
-	case string:
-		return v
-	case int, int32, int64, uint, uint32, uint64:
-		return fmt.Sprintf("%d", v)
-	case float32, float64:
-		return fmt.Sprintf("%f", v)
-	default:
-		return fmt.Sprintf("%s", v)
-	}
+	return Any("", i).String()
 }
 
 // Define log level constants, used for setting log level by user.
@@ -73,11 +110,41 @@ const (
 	LevelFatal = "fatal"
 )
 
+// parseLevel parses log level, from debug to fatal.
+func parseLevel(level string) (log.Level, error) {
+	v, ok := log.Level_value[level]
+	if !ok || level == log.Level_none.String() {
+		return log.Level_none, errors.New("unknown log level: %q", level)
+	}
+	return log.Level(v), nil
+}
+
+// parseCallLevel parses level of a call log, such as of gRPC or HTTP, which
+// is not fatal, as fatal logs panic.
+func parseCallLevel(level string) (log.Level, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return lvl, err
+	}
+	if lvl == log.Level_fatal {
+		return log.Level_none, errors.New("fatal level not allowed for call logs")
+	}
+	return lvl, nil
+}
+
 func SetLevel(level string) {
+	std.SetLevel(level)
+}
+
+func (l *Logger) SetLevel(level string) {
 	l.conf.logLevel = log.Level(log.Level_value[level])
 }
 
 func GetLevel() string {
+	return std.GetLevel()
+}
+
+func (l *Logger) GetLevel() string {
 	return l.conf.logLevel.String()
 }
 
@@ -92,21 +159,47 @@ func V(verbosity int32) *Verbosity {
 	return &v
 }
 
+// V creates new verbosity, for logs sent via this logger.
+func (l *Logger) V(verbosity int32) *VTags {
+	return &VTags{l, V(verbosity), nil}
+}
+
 // V updates verbosity
 func (vtags *VTags) V(verbosity int32) *VTags {
 	vtags.v = V(verbosity)
 	return vtags
 }
 
-// verbose checks if it is verbose as current config.
-func (v *Verbosity) verbose() bool {
-	return int32(*v) <= l.conf.logVerbosity
+// verbose checks if it is verbose as config of given logger, or as
+// vmodule rules for the call site.
+func (v *Verbosity) verbose(l *Logger) bool {
+	if int32(*v) <= l.conf.logVerbosity {
+		return true
+	}
+	return l.vmoduleVerbose(int32(*v), 0)
+}
+
+// verboseDepth checks if it is verbose, as verbose, for the call site depth
+// frames above caller of log method.
+func (v *Verbosity) verboseDepth(l *Logger, depth int) bool {
+	if int32(*v) <= l.conf.logVerbosity {
+		return true
+	}
+	return l.vmoduleVerbose(int32(*v), depth)
 }
 
 func SetVerbosity(v int32) {
+	std.SetVerbosity(v)
+}
+
+func (l *Logger) SetVerbosity(v int32) {
 	l.conf.logVerbosity = v
 }
 
 func GetVerbosity() int32 {
+	return std.GetVerbosity()
+}
+
+func (l *Logger) GetVerbosity() int32 {
 	return l.conf.logVerbosity
 }
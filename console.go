@@ -0,0 +1,189 @@
+package log
+
+// Encode logs for reading on a terminal.
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// defaultFileWidth is the default width file:line is padded to.
+const defaultFileWidth = 24
+
+// ANSI escape codes used by console format.
+const (
+	colorReset  = "\x1b[0m"
+	colorDim    = "\x1b[2m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorPurple = "\x1b[35m"
+	colorBold   = "\x1b[1m"
+)
+
+// ConsoleEncoder encodes logs for reading on a terminal, as:
+//
+//	15:04:05.123 INFO  edge.go:120              sent logs  count=12
+//
+// Time is local, as in text format, for people reading along on the
+// machine, whereas JSON and logfmt times are UTC, for parsers. Level is
+// coloured, file:line is padded to FileWidth, tags are dimmed, and lines
+// of multi-line messages, such as stack traces, are indented to align with
+// the first line.
+type ConsoleEncoder struct {
+	Color     bool // colour levels and dim tags
+	FileWidth int  // width file:line is padded to, default if 0
+}
+
+// Console prints logs of default logger in console format.
+func Console() {
+	std.Console()
+}
+
+// Console prints logs in console format, coloured if stdout is a terminal
+// and NO_COLOR environment variable is not set.
+func (l *Logger) Console() {
+	l.conf.console.Store(&ConsoleEncoder{Color: colorEnabled(l.getStdout())})
+	l.setLocalFormat(FormatConsole)
+}
+
+// getConsole returns console encoder of logger.
+func (l *Logger) getConsole() *ConsoleEncoder {
+	if enc, _ := l.conf.console.Load().(*ConsoleEncoder); enc != nil {
+		return enc
+	}
+	return &ConsoleEncoder{}
+}
+
+// colorEnabled checks if colours may be printed to file, i.e. if it is a
+// terminal and NO_COLOR is not set.
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// isTerminal checks if file is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Format appends log encoded for console to buf.
+func (enc *ConsoleEncoder) Format(lg *log.Log, buf []byte) []byte {
+	return enc.FormatEntry(NewEntry(lg), buf)
+}
+
+// FormatEntry appends log entry encoded for console to buf.
+func (enc *ConsoleEncoder) FormatEntry(e *Entry, buf []byte) []byte {
+	lg := e.Log
+	start := len(buf)
+
+	// time and level
+	buf = e.time().Local().AppendFormat(buf, "15:04:05.000")
+	buf = append(buf, ' ')
+	buf = enc.appendLevel(buf, lg.Level)
+	buf = append(buf, ' ')
+
+	// file:line, padded
+	if lg.Level != log.Level_none {
+		width := enc.FileWidth
+		if width == 0 {
+			width = defaultFileWidth
+		}
+		fileStart := len(buf)
+		if lg.GetFile() != "" {
+			buf = append(buf, lg.GetFile()...)
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(lg.GetLine()), 10)
+		}
+		for len(buf)-fileStart < width {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, ' ')
+	}
+
+	// message, or raw log, with following lines aligned to first
+	indent := len(buf) - start
+	if enc.Color {
+		// escape codes take no space
+		indent -= len(colorReset) + len(levelColor(lg.Level))
+	}
+	msg := lg.GetMsg()
+	if lg.Level == log.Level_none {
+		msg = lg.GetRaw()
+	}
+	buf = appendIndented(buf, strings.TrimRight(msg, "\n"), indent)
+
+	// tags, dimmed
+	if len(e.Tags) == 0 {
+		return buf
+	}
+	buf = append(buf, ' ')
+	if enc.Color {
+		buf = append(buf, colorDim...)
+	}
+	for _, tag := range e.Tags {
+		buf = append(buf, ' ')
+		buf = appendLogfmtKey(buf, tag.Key)
+		buf = append(buf, '=')
+		buf = appendLogfmtValue(buf, tag.Value)
+	}
+	if enc.Color {
+		buf = append(buf, colorReset...)
+	}
+	return buf
+}
+
+// appendLevel appends level name, padded and coloured.
+func (enc *ConsoleEncoder) appendLevel(buf []byte, level log.Level) []byte {
+	name := strings.ToUpper(levelName(level))
+	if enc.Color {
+		buf = append(buf, levelColor(level)...)
+		buf = append(buf, name...)
+		buf = append(buf, colorReset...)
+	} else {
+		buf = append(buf, name...)
+	}
+	for i := len(name); i < len("fatal"); i++ {
+		buf = append(buf, ' ')
+	}
+	return buf
+}
+
+// levelColor returns escape code colouring level.
+func levelColor(level log.Level) string {
+	switch level {
+	case log.Level_debug:
+		return colorBlue
+	case log.Level_info:
+		return colorGreen
+	case log.Level_warn:
+		return colorYellow
+	case log.Level_error:
+		return colorRed
+	case log.Level_fatal:
+		return colorBold + colorPurple
+	}
+	return colorDim
+}
+
+// appendIndented appends s, indenting lines after the first.
+func appendIndented(buf []byte, s string, indent int) []byte {
+	for {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			return append(buf, s...)
+		}
+		buf = append(buf, s[:i+1]...)
+		for j := 0; j < indent; j++ {
+			buf = append(buf, ' ')
+		}
+		s = s[i+1:]
+	}
+}
@@ -0,0 +1,50 @@
+package log
+
+import (
+	"context"
+)
+
+// contextKey is the key for tags stored in a context.
+type contextKey struct{}
+
+// NewContext returns a context carrying given tags and verbosity. Tags
+// already in the parent context are kept, unless overwritten by given tags.
+func NewContext(ctx context.Context, vtags *VTags) context.Context {
+	merged := vtags.copy()
+	if parent, ok := ctx.Value(contextKey{}).(*VTags); ok {
+		merged.fields = append(parent.copy().fields, merged.fields...)
+	}
+	return context.WithValue(ctx, contextKey{}, merged)
+}
+
+// FromContext returns tags and verbosity carried by context, or empty tags
+// for default logger if none.
+func FromContext(ctx context.Context) *VTags {
+	vtags, ok := ctx.Value(contextKey{}).(*VTags)
+	if !ok {
+		return &VTags{std, defaultVerbosity, nil}
+	}
+	return vtags.copy()
+}
+
+// Ctx returns tags and verbosity carried by context, for logging with them.
+//   log.Ctx(ctx).I("tagged with request tags")
+func Ctx(ctx context.Context) *VTags {
+	return FromContext(ctx)
+}
+
+// Ctx returns tags and verbosity carried by context, for logging with them
+// via this logger.
+func (l *Logger) Ctx(ctx context.Context) *VTags {
+	vtags := FromContext(ctx)
+	vtags.l = l
+	return vtags
+}
+
+// copy returns a copy of vtags, so that tags added to copy do not modify
+// tags shared via context.
+func (vtags *VTags) copy() *VTags {
+	fields := make([]Field, len(vtags.fields))
+	copy(fields, vtags.fields)
+	return &VTags{vtags.l, vtags.v, fields}
+}
@@ -27,101 +27,302 @@ const retryLimit = 4
 // Tx trasmits messages to edge server.
 // Exported to enable unit test of api server.
 type Tx struct {
+	l          *Logger
 	token      string
+	tokenKey   string // API key of token
+	address    string // edge address of connection
+	conn       *grpc.ClientConn
 	edgeClient edge.EdgeClient
 	logClient  edge.Edge_PostLogsClient
 	logMap     map[string]int32
 	latency    int32
 	errCount   int32
 	retryCount int
+	breaker    *Breaker
 }
 
 func NewTx() *Tx {
 	return &Tx{logMap: make(map[string]int32)}
 }
 
+// flushDuration is the interval of sending logs to edge.
+const flushDuration = time.Second
+
+// senderDaemon is a running sender daemon.
+type senderDaemon struct {
+	stop chan struct{} // closed to stop daemon
+	done chan struct{} // closed once daemon stopped
+}
+
 // sender daemon
 // - creates a transmitter that sends messages to edge server
 // - aggregates logs coming over edge channel
 // - periodically sends aggregated logs to edge server (via created tx)
 // - handles request to flush all logs immediately
-func sender() {
+// - stops on request, closing connection to edge server
+// Only one daemon runs per logger.
+func (l *Logger) sender() {
+
+	l.senderMu.Lock()
+	defer l.senderMu.Unlock()
+	if l.daemon != nil {
+		select {
+		case <-l.daemon.stop:
+			// wait for daemon that did not stop in time, so that only
+			// one daemon sends logs
+			<-l.daemon.done
+		default:
+			return
+		}
+	}
+	daemon := &senderDaemon{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	l.daemon = daemon
 
 	// create new transmitter
 	tx := NewTx()
+	tx.l = l
+	tx.breaker = NewBreaker(l.conf.breakerThreshold,
+		l.conf.breakerCooldown, l.conf.clock)
 
 	// initialize transmitter
 	var lgs []*log.Log
 
-	// initialize pause counter
-	var pause int
+	// fires when backoff after a failure is over, nil if not backing off
+	var retry <-chan time.Time
 
-	// create flush channel
-	fchan := createFlushChannel()
+	// send logs, backing off after failures
+	send := func() {
+		var delay time.Duration
+		lgs, delay = tx.send(lgs)
+		if delay > 0 {
+			retry = l.conf.clock.After(delay)
+		}
+	}
 
 	// accumulate and send logs
 	go func() {
+		flushTick := time.NewTicker(flushDuration)
+		defer close(daemon.done)
+		defer flushTick.Stop()
+		defer tx.close()
+
 		for {
 			select {
-			case <-fchan:
-				if pause == 0 {
-					lgs, pause = tx.send(lgs)
-					continue
+			case <-flushTick.C:
+				if retry == nil {
+					send()
+				}
+			case <-l.flushChannel:
+				if retry == nil {
+					send()
 				}
-				pause--
+			case <-retry:
+				retry = nil
+				send()
 			case lg := <-l.edgeChannel:
 				lgs = append(lgs, lg)
+			case <-daemon.stop:
+				l.discard(lgs)
+				return
 			}
 		}
 	}()
 }
 
-func createFlushChannel() chan bool {
-	fchan := make(chan bool)
-	flushDuration := time.Second
-	flushTick := time.NewTicker(flushDuration)
-	go func() {
-		for {
-			select {
-			case <-flushTick.C:
-				fchan <- true
-			case <-l.flushChannel:
-				fchan <- true
-			}
+// stopSender stops sender daemon, if running, and waits for it to stop or
+// context to be done.
+func (l *Logger) stopSender(ctx context.Context) error {
+	l.senderMu.Lock()
+	daemon := l.daemon
+	if daemon != nil {
+		select {
+		case <-daemon.stop:
+		default:
+			close(daemon.stop)
 		}
-	}()
-	return fchan
+	}
+	l.senderMu.Unlock()
+
+	if daemon == nil {
+		return nil
+	}
+
+	// daemon is left in place till it stops, so no other daemon starts
+	select {
+	case <-daemon.done:
+		l.senderMu.Lock()
+		if l.daemon == daemon {
+			l.daemon = nil
+		}
+		l.senderMu.Unlock()
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "sender daemon did not stop")
+	}
+}
+
+// discard takes care of unsent logs, and logs left in edge channel, when
+// sender daemon stops. Logs are spooled if spool is set, else dropped.
+func (l *Logger) discard(lgs []*log.Log) {
+drain:
+	for {
+		select {
+		case lg := <-l.edgeChannel:
+			lgs = append(lgs, lg)
+		default:
+			break drain
+		}
+	}
+
+	lgs = l.spoolLogs(l.getSpool(), lgs)
+	if len(lgs) > 0 {
+		l.pending.done(int64(len(lgs)))
+		l.internalError(&InternalError{
+			Stage: StageSend,
+			Err:   errors.New("closed with %d logs unsent", len(lgs)),
+		})
+	}
+}
+
+// edgeSink sends logs to edge server via sender daemon of logger.
+type edgeSink struct {
+	l *Logger
+}
+
+// Write pushes log to edge channel, if api key is set and no errors
+// sending to edge.
+func (s *edgeSink) Write(lg *log.Log) error {
+	l := s.l
+	if l.emitting() {
+		l.pushEdge(lg)
+	}
+	return nil
+}
+
+// Flush requests sender daemon to send logs immediately, and waits for
+// all logs to be sent, in bounded time.
+func (s *edgeSink) Flush() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFlushTimeout)
+	defer cancel()
+	return s.FlushContext(ctx)
+}
+
+// FlushContext requests sender daemon to send logs immediately, and waits
+// for all logs to be sent, or context to be done.
+func (s *edgeSink) FlushContext(ctx context.Context) error {
+	select {
+	case s.l.flushChannel <- true:
+	default: // flush already requested
+	}
+	return s.l.pending.wait(ctx)
+}
+
+// Close is a no-op, sender daemon keeps running.
+func (s *edgeSink) Close() error {
+	return nil
 }
 
 // send logs to edge client, with exponential backtracking in case of failures.
-func (tx *Tx) send(lgs []*log.Log) ([]*log.Log, int) {
+// If spool is set, logs that can not be sent are spooled to disk, and sent
+// in order once connection is back. Returns unsent logs and delay before
+// next attempt.
+func (tx *Tx) send(lgs []*log.Log) ([]*log.Log, time.Duration) {
 
-	defer func() {
-		l.errFile.Sync()
-	}()
+	l := tx.l
+	sp := l.getSpool()
+
+	// spooled logs are older, so spool new logs too to keep order
+	if sp != nil && !sp.empty() {
+		lgs = l.spoolLogs(sp, lgs)
+	}
+
+	// do not attempt while circuit breaker is open
+	if !tx.breaker.Allow() {
+		return l.spoolLogs(sp, lgs), 0
+	}
+
+	// connect to edge server
+	if !tx.connect() {
+		tx.breaker.Failure()
+		return l.spoolLogs(sp, lgs), tx.delay()
+	}
+
+	// send spooled logs first
+	if sp != nil && !tx.drain(sp) {
+		tx.breaker.Failure()
+		return l.spoolLogs(sp, lgs), tx.delay()
+	}
+
+	// send logs
+	if !tx.post(lgs) {
+		tx.breaker.Failure()
+		return l.spoolLogs(sp, lgs), tx.delay()
+	}
+
+	// count logs delivered
+	l.pending.done(int64(len(lgs)))
+
+	// update error and retry count
+	tx.breaker.Success()
+	tx.errCount = 0
+	tx.retryCount = 0
+
+	return nil, 0
+}
+
+// delay returns backoff delay before next attempt, growing with errors
+// since last successful attempt.
+func (tx *Tx) delay() time.Duration {
+	return tx.l.conf.backoff.Delay(int(tx.errCount) - 1)
+}
+
+// connect creates edge client, token and log client as needed.
+func (tx *Tx) connect() bool {
+
+	l := tx.l
 
 	var err error
 
+	// reconnect if edge address changed
+	if tx.edgeClient != nil && tx.address != l.conf.edgeAddress {
+		tx.close()
+	}
+
+	// get new token if API key changed
+	if tx.token != "" && tx.tokenKey != l.getAPIKey() {
+		tx.token = ""
+	}
+
 	// create edge client if does not exist
 	if tx.edgeClient == nil {
-		tx.edgeClient, err = getEdgeClient()
+		tx.address = l.conf.edgeAddress
+		tx.conn, err = l.getEdgeConn()
 		if err == nil {
+			tx.edgeClient = edge.NewEdgeClient(tx.conn)
 			tx.retryCount = 0
 		}
 	}
 
 	// handle edge client error
 	if err != nil {
-		l.errFile.WriteString(fmt.Sprintf("edge client error: %v\n", err))
+		l.internalError(&InternalError{
+			Stage: StageEdgeClient,
+			Retry: tx.retryCount,
+			Err:   err,
+		})
 		tx.errCount++
 		tx.retryCount++
-		return lgs, 2 ^ (tx.retryCount - 1)
+		return false
 	}
 
 	// create token if empty
 	if tx.token == "" {
 		startMs := nowMs()
-		tx.token, err = getToken(tx.edgeClient, l.conf.apiKey)
+		tx.tokenKey = l.getAPIKey()
+		tx.token, err = l.getToken(tx.edgeClient, tx.tokenKey)
 		tx.latency = int32(nowMs() - startMs)
 
 		// clear retry count
@@ -132,17 +333,21 @@ func (tx *Tx) send(lgs []*log.Log) ([]*log.Log, int) {
 
 	// handle get token error
 	if err != nil {
-		l.errFile.WriteString(fmt.Sprintf("token error: %v\n", err))
-
-		// if at retry limit then backtrack
+		l.internalError(&InternalError{
+			Stage:     StageToken,
+			Retry:     tx.retryCount,
+			Backtrack: tx.retryCount == retryLimit,
+			Err:       err,
+		})
+
+		// if at retry limit then backtrack to edge client
 		if tx.retryCount == retryLimit {
-			l.errFile.WriteString("backtracking to edge client\n")
-			tx.edgeClient = nil
+			tx.close()
 			tx.retryCount = 0
 		}
 		tx.errCount++
 		tx.retryCount++
-		return lgs, 2 ^ (tx.retryCount - 1)
+		return false
 	}
 
 	// create log client
@@ -156,19 +361,50 @@ func (tx *Tx) send(lgs []*log.Log) ([]*log.Log, int) {
 
 	// handle log client error
 	if err != nil {
-		l.errFile.WriteString(fmt.Sprintf("log client error: %v\n", err))
-
-		// if at retry limit then backtrack
+		l.internalError(&InternalError{
+			Stage:     StageLogClient,
+			Retry:     tx.retryCount,
+			Backtrack: tx.retryCount == retryLimit,
+			Err:       err,
+		})
+
+		// if at retry limit then backtrack to get token
 		if tx.retryCount == retryLimit {
-			l.errFile.WriteString("backtracking to get token\n")
 			tx.token = ""
 			tx.retryCount = 0
 		}
 		tx.errCount++
 		tx.retryCount++
-		return lgs, 2 ^ (tx.retryCount - 1)
+		return false
 	}
 
+	return true
+}
+
+// drain sends spooled logs in order, up to drain limit per call.
+func (tx *Tx) drain(sp *spool) bool {
+	for i := 0; i < spoolDrainLimit; i++ {
+		logs, err := sp.peek()
+		if err != nil {
+			tx.l.internalError(&InternalError{Stage: StageSpool, Err: err})
+			continue
+		}
+		if logs == nil {
+			return true
+		}
+		if !tx.post(decodeBatch(logs)) {
+			return false
+		}
+		sp.pop()
+	}
+	return true
+}
+
+// post aggregates and sends logs over log client.
+func (tx *Tx) post(lgs []*log.Log) bool {
+
+	l := tx.l
+
 	// aggregate logs
 	logs := new(log.Logs)
 	for _, lg := range lgs {
@@ -176,30 +412,32 @@ func (tx *Tx) send(lgs []*log.Log) ([]*log.Log, int) {
 	}
 
 	// send logs
-	tx.latency, err = sendLogs(tx.logClient, tx.token, logs, tx.latency, tx.errCount)
+	var err error
+	tx.latency, err = l.sendLogs(tx.logClient, tx.token, logs, tx.latency, tx.errCount)
 
 	// handle send log errors
 	if err != nil {
-		l.errFile.WriteString(fmt.Sprintf("error sending logs: %v\n", err))
-
-		// if at retry limit then backtrack
+		l.internalError(&InternalError{
+			Stage:     StageSend,
+			Retry:     tx.retryCount,
+			Backtrack: tx.retryCount == retryLimit,
+			Err:       err,
+		})
+
+		// if at retry limit then backtrack to get log client
 		if tx.retryCount == retryLimit {
-			l.errFile.WriteString("backtracking to get log client\n")
+			tx.logClient.CloseSend()
 			tx.logClient = nil
-			resetGlobalTags()
+			l.resetGlobalTags()
 			tx.retryCount = 0
 		}
 
 		tx.errCount++
 		tx.retryCount++
-		return lgs, 2 ^ (tx.retryCount - 1)
+		return false
 	}
 
-	// update error and retry count
-	tx.errCount = 0
-	tx.retryCount = 0
-
-	return nil, 2 ^ 0
+	return true
 }
 
 // Append log to encoded logs.
@@ -235,11 +473,11 @@ func (tx *Tx) Append(logs *log.Logs, lg *log.Log) *log.Logs {
 // Tracks latency and error count of messages to edge server. Each message
 // includes latency for, and count of errors since last last successful
 // message sent to edge server.
-func sendLogs(logClient edge.Edge_PostLogsClient, token string,
+func (l *Logger) sendLogs(logClient edge.Edge_PostLogsClient, token string,
 	logs *log.Logs, latency, errCount int32) (int32, error) {
 
 	// get global tags
-	logs.InstTags = getGlobalTags()
+	logs.InstTags = l.getGlobalTags()
 
 	// return if nothing to send
 	if len(logs.Vals) == 0 && len(logs.InstTags) == 0 && len(logs.Raws) == 0 {
@@ -277,24 +515,16 @@ func sendLogs(logClient edge.Edge_PostLogsClient, token string,
 
 	// update log level and verbosity based on response
 	if resp.GetLogLevel() != log.Level_none {
-		SetLevel(resp.GetLogLevel().String())
+		l.SetLevel(resp.GetLogLevel().String())
 	}
 	// verbosity is encoded as +1, so we subtract 1 and apply
 	if resp.GetLogVerbosity() != 0 {
-		SetVerbosity(resp.GetLogVerbosity() - 1)
+		l.SetVerbosity(resp.GetLogVerbosity() - 1)
 	}
 
 	// calculate latency for sending logs to edge server
 	latency = int32(nowMs() - startMs)
 
-	// update wait group for each log sent
-	for _ = range logs.Vals {
-		l.wg.Done()
-	}
-	for _ = range logs.Raws {
-		l.wg.Done()
-	}
-
 	return latency, nil
 }
 
@@ -319,7 +549,7 @@ func getLookupKey(logKey *log.LogKey) string {
 
 // getCredentials uses hardcoded certificate to create TLS credentials
 // that would be used to connect to edge server.
-func getCredentials() (credentials.TransportCredentials, error) {
+func (l *Logger) getCredentials() (credentials.TransportCredentials, error) {
 	b := []byte(l.conf.edgeCert)
 	cp := x509.NewCertPool()
 	if !cp.AppendCertsFromPEM(b) {
@@ -328,13 +558,29 @@ func getCredentials() (credentials.TransportCredentials, error) {
 	return credentials.NewTLS(&tls.Config{RootCAs: cp}), nil
 }
 
-// getEdgeClient creates new edge client.
-func getEdgeClient() (edge.EdgeClient, error) {
+// close closes log client and connection to edge server, if any, so that
+// next send connects again.
+func (tx *Tx) close() {
+	if tx.logClient != nil {
+		tx.logClient.CloseSend()
+		tx.logClient = nil
+		tx.l.resetGlobalTags()
+	}
+	if tx.conn != nil {
+		tx.conn.Close()
+		tx.conn = nil
+	}
+	tx.edgeClient = nil
+	tx.token = ""
+}
+
+// getEdgeConn creates new connection to edge server.
+func (l *Logger) getEdgeConn() (*grpc.ClientConn, error) {
 
 	// DEBUG: use debug connector for logging dialer errors.
 	//conn, err := debugConn()
 
-	creds, err := getCredentials()
+	creds, err := l.getCredentials()
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting credentials")
 	}
@@ -344,13 +590,13 @@ func getEdgeClient() (edge.EdgeClient, error) {
 		return nil, errors.Wrap(err, "error dialing to server")
 	}
 
-	return edge.NewEdgeClient(conn), nil
+	return conn, nil
 }
 
 // debugConn creats a grpc connection that logs dialer errors.
-func debugConn() (*grpc.ClientConn, error) {
+func (l *Logger) debugConn() (*grpc.ClientConn, error) {
 
-	creds, err := getCredentials()
+	creds, err := l.getCredentials()
 	if err != nil {
 		return nil, errors.Wrap(err, "error getting credentials")
 	}
@@ -385,7 +631,7 @@ func debugConn() (*grpc.ClientConn, error) {
 }
 
 // getToken uses API key to get a token from edge server.
-func getToken(c edge.EdgeClient, keyId string) (string, error) {
+func (l *Logger) getToken(c edge.EdgeClient, keyId string) (string, error) {
 
 	authRequest := &edge.AuthRequest{
 		Version: version,
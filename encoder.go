@@ -0,0 +1,146 @@
+package log
+
+// Fields of encoded logs, shared by JSON and logfmt encoders.
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// encoderTimeFormat is RFC 3339 in UTC with nanoseconds, fixed width so
+// times line up.
+const encoderTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// inlineTagPrefix prefixes inlined tags with the key of another field.
+const inlineTagPrefix = "tag."
+
+// EncoderKeys are the key names of log fields in encoded logs. Empty key
+// leaves the field out, except that empty Line key appends line to file,
+// as file:line, and empty Tags key inlines tags with other fields. Inlined
+// tags with the key of another field are prefixed with "tag.", so they do
+// not shadow it.
+type EncoderKeys struct {
+	Level     string
+	Time      string
+	File      string
+	Line      string
+	Function  string
+	Verbosity string
+	Msg       string
+	Raw       string
+	Tags      string // key tags are nested under
+}
+
+// fieldEncoder encodes fields in a format.
+type fieldEncoder interface {
+	// appendKey appends key of next field, first if no field precedes it.
+	appendKey(buf []byte, key string, first bool) []byte
+	appendString(buf []byte, s string) []byte
+	appendTime(buf []byte, t time.Time) []byte
+	// appendTags appends tags in order, nested under Tags key or inlined if
+	// it is empty.
+	appendTags(buf []byte, keys *EncoderKeys, tags EntryTags, first bool) []byte
+}
+
+// inlineKey returns key of an inlined tag, prefixed if it is the key of
+// another field.
+func (keys *EncoderKeys) inlineKey(k string) string {
+	switch k {
+	case keys.Level, keys.Time, keys.File, keys.Line, keys.Function,
+		keys.Verbosity, keys.Msg, keys.Raw:
+		if k != "" {
+			return inlineTagPrefix + k
+		}
+	}
+	return k
+}
+
+// appendFields appends fields of log entry, in order of time, level, file,
+// line, function, verbosity, msg, or raw for raw logs, and tags.
+func appendFields(buf []byte, e *Entry, keys *EncoderKeys, enc fieldEncoder) []byte {
+	lg := e.Log
+	first := true
+
+	if keys.Time != "" {
+		buf = enc.appendKey(buf, keys.Time, first)
+		buf = enc.appendTime(buf, e.time())
+		first = false
+	}
+	if keys.Level != "" {
+		buf = enc.appendKey(buf, keys.Level, first)
+		buf = enc.appendString(buf, levelName(lg.Level))
+		first = false
+	}
+
+	if lg.Level == log.Level_none {
+		if keys.Raw != "" {
+			buf = enc.appendKey(buf, keys.Raw, first)
+			buf = enc.appendString(buf, lg.GetRaw())
+			first = false
+		}
+	} else {
+		// location is omitted if not known, such as for Writer
+		if keys.File != "" && lg.GetFile() != "" {
+			buf = enc.appendKey(buf, keys.File, first)
+			if keys.Line == "" {
+				buf = enc.appendString(buf, lg.GetFile()+":"+
+					strconv.Itoa(int(lg.GetLine())))
+			} else {
+				buf = enc.appendString(buf, lg.GetFile())
+			}
+			first = false
+		}
+		if keys.Line != "" && lg.GetFile() != "" {
+			buf = enc.appendKey(buf, keys.Line, first)
+			buf = strconv.AppendInt(buf, int64(lg.GetLine()), 10)
+			first = false
+		}
+		if keys.Function != "" && lg.GetFunction() != "" {
+			buf = enc.appendKey(buf, keys.Function, first)
+			buf = enc.appendString(buf, lg.GetFunction())
+			first = false
+		}
+		if keys.Verbosity != "" {
+			buf = enc.appendKey(buf, keys.Verbosity, first)
+			buf = strconv.AppendInt(buf, int64(lg.GetVerbosity()), 10)
+			first = false
+		}
+		if keys.Msg != "" {
+			buf = enc.appendKey(buf, keys.Msg, first)
+			buf = enc.appendString(buf, lg.GetMsg())
+			first = false
+		}
+	}
+
+	if len(e.Tags) != 0 {
+		buf = enc.appendTags(buf, keys, e.Tags, first)
+	}
+	return buf
+}
+
+// bufPool pools buffers for encoding logs.
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 512)
+		return &b
+	},
+}
+
+// logTime returns time of log, in UTC.
+func logTime(lg *log.Log) time.Time {
+	return time.Unix(0, lg.GetTimestamp()*int64(time.Millisecond)).UTC()
+}
+
+// levelName returns name of level, "raw" for raw logs.
+func levelName(level log.Level) string {
+	if level == log.Level_none {
+		return "raw"
+	}
+	return level.String()
+}
+
+// hexDigits are digits of escaped characters.
+const hexDigits = "0123456789abcdef"
@@ -0,0 +1,267 @@
+package log
+
+// Configure logger from environment variables and command line flags.
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/blitzlog/errors"
+)
+
+// Environment variables read by LoadEnv, all optional.
+const (
+	EnvAPIKey      = "BLITZLOG_API_KEY"      // API key, sends logs to edge
+	EnvEdgeAddress = "BLITZLOG_EDGE_ADDRESS" // edge address, host:port
+	EnvEdgeCert    = "BLITZLOG_EDGE_CERT"    // path to edge certificate
+	EnvLevel       = "BLITZLOG_LEVEL"        // minimum log level
+	EnvVerbosity   = "BLITZLOG_VERBOSITY"    // maximum log verbosity
+	EnvVModule     = "BLITZLOG_VMODULE"      // verbosity per file, see SetVModule
+	EnvFormat      = "BLITZLOG_FORMAT"       // local format: text, json, logfmt, console or a template
+	EnvLocal       = "BLITZLOG_LOCAL"        // print logs to stdout, bool
+	EnvCapture     = "BLITZLOG_CAPTURE"      // capture stdout, stderr or both
+)
+
+// Local formats, set via environment or flags.
+const (
+	FormatText    = "text"
+	FormatJSON    = "json"
+	FormatLogfmt  = "logfmt"
+	FormatConsole = "console"
+)
+
+// LoadEnv configures default logger from environment variables.
+func LoadEnv() error {
+	return std.LoadEnv()
+}
+
+// EnvError lists errors loading environment, one per invalid variable,
+// wrapped with its name.
+type EnvError []error
+
+// Error returns errors of all variables, separated by semicolons.
+func (e EnvError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// LoadEnv configures logger from BLITZLOG_* environment variables. Unset
+// variables leave config as is. Invalid variables are skipped, to apply
+// all valid ones, and reported together as EnvError. Default logger loads
+// environment at start.
+func (l *Logger) LoadEnv() error {
+
+	// set api key last, as it starts sending logs to edge
+	vars := []struct {
+		name string
+		set  func(string) error
+	}{
+		{EnvLevel, l.setLevel},
+		{EnvVerbosity, l.setVerbosity},
+		{EnvVModule, l.SetVModule},
+		{EnvFormat, l.setFormat},
+		{EnvLocal, func(v string) error { return setBool(&l.conf.logLocal, v) }},
+		{EnvEdgeAddress, func(v string) error { l.conf.edgeAddress = v; return nil }},
+		{EnvEdgeCert, l.setEdgeCert},
+		{EnvCapture, l.setCapture},
+		{EnvAPIKey, func(v string) error {
+			if v != "" {
+				l.SetAPIKey(v)
+			}
+			return nil
+		}},
+	}
+
+	var errs EnvError
+	for _, ev := range vars {
+		if v, ok := os.LookupEnv(ev.name); ok {
+			if err := ev.set(v); err != nil {
+				errs = append(errs, errors.Wrap(err, ev.name))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// RegisterFlags registers flags to configure default logger.
+func RegisterFlags(fs *flag.FlagSet) {
+	std.RegisterFlags(fs)
+}
+
+// RegisterFlags registers flags to configure logger, applied as flags are
+// parsed. Flags default to current config.
+//   log.RegisterFlags(flag.CommandLine)
+//   flag.Parse()
+func (l *Logger) RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(&flagValue{l.GetLevel, l.setLevel, false},
+		"log.level", "minimum log level: debug, info, warn, error or fatal")
+	fs.Var(&flagValue{
+		func() string { return strconv.Itoa(int(l.GetVerbosity())) },
+		l.setVerbosity, false},
+		"log.v", "maximum log verbosity")
+	fs.Var(&flagValue{
+		func() string { return "" },
+		l.SetVModule, false},
+		"log.vmodule", "verbosity per file, as pattern=verbosity list")
+	fs.Var(&flagValue{
+		func() string { return strconv.FormatBool(l.conf.logFormat == FormatJSON) },
+		l.setJSON, true},
+		"log.json", "print logs as json")
+	fs.Var(&flagValue{
+		func() string { return l.getFormat() },
+		l.setFormat, false},
+		"log.format", "local format: text, json, logfmt, console or a template")
+	fs.Var(&flagValue{
+		func() string { return strconv.FormatBool(l.conf.logLocal) },
+		func(v string) error { return setBool(&l.conf.logLocal, v) }, true},
+		"log.local", "print logs to stdout")
+	fs.Var(&flagValue{
+		func() string { return "" },
+		l.setCapture, false},
+		"log.capture", "capture stdout, stderr or both, as comma separated list")
+	fs.Var(&flagValue{
+		func() string { return l.conf.edgeAddress },
+		func(v string) error { l.conf.edgeAddress = v; return nil }, false},
+		"log.edge_address", "edge address, host:port")
+	fs.Var(&flagValue{
+		func() string { return "" },
+		l.setEdgeCert, false},
+		"log.edge_cert", "path to edge certificate")
+	fs.Var(&flagValue{
+		func() string { return "" },
+		func(v string) error { l.SetAPIKey(v); return nil }, false},
+		"log.api_key", "API key, sends logs to edge")
+}
+
+// flagValue sets a config value from a flag.
+type flagValue struct {
+	get    func() string
+	set    func(string) error
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	// flag package may call String on a zero value
+	if f.get == nil {
+		return ""
+	}
+	return f.get()
+}
+
+func (f *flagValue) Set(v string) error {
+	return f.set(v)
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// setLevel sets log level, validating its name.
+func (l *Logger) setLevel(level string) error {
+	if _, err := parseLevel(level); err != nil {
+		return err
+	}
+	l.SetLevel(level)
+	return nil
+}
+
+// setVerbosity sets verbosity from its string form.
+func (l *Logger) setVerbosity(v string) error {
+	verbosity, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return err
+	}
+	l.SetVerbosity(int32(verbosity))
+	return nil
+}
+
+// setFormat sets local format, by name or as a template.
+func (l *Logger) setFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON, FormatLogfmt:
+		l.setLocalFormat(format)
+	case FormatConsole:
+		l.Console()
+	default:
+		if isTemplate(format) {
+			f, err := l.Template(format)
+			if err != nil {
+				return err
+			}
+			l.SetFormatter(f)
+			return nil
+		}
+		return errors.New("unknown log format: %q", format)
+	}
+	return nil
+}
+
+// setCapture captures outputs in comma separated list.
+func (l *Logger) setCapture(v string) error {
+	for _, name := range strings.Split(v, ",") {
+		var err error
+		switch strings.TrimSpace(name) {
+		case "":
+		case "stdout":
+			err = l.CaptureStdout()
+		case "stderr":
+			err = l.CaptureStderr()
+		default:
+			err = errors.New("unknown output: %q", name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFormat returns local format.
+func (l *Logger) getFormat() string {
+	if l.conf.logFormat == "" {
+		return FormatText
+	}
+	return l.conf.logFormat
+}
+
+// setJSON sets local format to json, or text, from its string form.
+func (l *Logger) setJSON(v string) error {
+	var json bool
+	if err := setBool(&json, v); err != nil {
+		return err
+	}
+	if json {
+		return l.setFormat(FormatJSON)
+	}
+	return l.setFormat(FormatText)
+}
+
+// setBool sets a boolean config from its string form.
+func setBool(b *bool, v string) error {
+	val, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*b = val
+	return nil
+}
+
+// setEdgeCert reads edge certificate from file.
+func (l *Logger) setEdgeCert(path string) error {
+	cert, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	l.conf.edgeCert = string(cert)
+	return nil
+}
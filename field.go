@@ -0,0 +1,199 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// fieldKind records the type of a field value.
+type fieldKind uint8
+
+const (
+	stringKind fieldKind = iota
+	intKind
+	uintKind
+	floatKind
+	boolKind
+	durationKind
+	timeKind
+	errorKind
+	anyKind
+)
+
+// Field is a typed tag. Values are kept as is, and encoded without
+// reflection when log is published. Tags reach sinks and edge as strings.
+type Field struct {
+	key  string
+	kind fieldKind
+	n    int32 // nanoseconds of time, bit size of float
+	i    int64 // integer, float bits, unix seconds of time
+	s    string
+	v    interface{} // error, location of time, any value
+}
+
+// Str creates a string tag.
+func Str(key, val string) Field {
+	return Field{key: key, kind: stringKind, s: val}
+}
+
+// Int creates an integer tag.
+func Int(key string, val int) Field {
+	return Field{key: key, kind: intKind, i: int64(val)}
+}
+
+// Int64 creates an integer tag.
+func Int64(key string, val int64) Field {
+	return Field{key: key, kind: intKind, i: val}
+}
+
+// Uint64 creates an unsigned integer tag.
+func Uint64(key string, val uint64) Field {
+	return Field{key: key, kind: uintKind, i: int64(val)}
+}
+
+// Float creates a floating point tag, encoded with full precision.
+func Float(key string, val float64) Field {
+	return Field{key: key, kind: floatKind, i: int64(math.Float64bits(val)), n: 64}
+}
+
+// Bool creates a boolean tag.
+func Bool(key string, val bool) Field {
+	f := Field{key: key, kind: boolKind}
+	if val {
+		f.i = 1
+	}
+	return f
+}
+
+// Dur creates a duration tag, encoded as 1h2m3.5s.
+func Dur(key string, val time.Duration) Field {
+	return Field{key: key, kind: durationKind, i: int64(val)}
+}
+
+// Time creates a time tag, encoded as RFC 3339 with nanoseconds.
+func Time(key string, val time.Time) Field {
+	return Field{key: key, kind: timeKind, i: val.Unix(), n: int32(val.Nanosecond()),
+		v: val.Location()}
+}
+
+// Err creates an error tag, keyed by ErrorKey.
+func Err(err error) Field {
+	return Field{key: ErrorKey, kind: errorKind, v: err}
+}
+
+// Any creates a tag of any type. Common types are encoded as their typed
+// fields, other types are formatted with fmt.
+func Any(key string, val interface{}) Field {
+	switch v := val.(type) {
+	case string:
+		return Str(key, v)
+	case int:
+		return Int(key, v)
+	case int8:
+		return Int64(key, int64(v))
+	case int16:
+		return Int64(key, int64(v))
+	case int32:
+		return Int64(key, int64(v))
+	case int64:
+		return Int64(key, v)
+	case uint:
+		return Uint64(key, uint64(v))
+	case uint8:
+		return Uint64(key, uint64(v))
+	case uint16:
+		return Uint64(key, uint64(v))
+	case uint32:
+		return Uint64(key, uint64(v))
+	case uint64:
+		return Uint64(key, v)
+	case float32:
+		return Field{key: key, kind: floatKind, i: int64(math.Float64bits(float64(v))), n: 32}
+	case float64:
+		return Float(key, v)
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Dur(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return Field{key: key, kind: errorKind, v: v}
+	default:
+		return Field{key: key, kind: anyKind, v: v}
+	}
+}
+
+// Key returns key of the field.
+func (f Field) Key() string {
+	return f.key
+}
+
+// String returns encoded value of the field.
+func (f Field) String() string {
+	return string(f.appendValue(nil))
+}
+
+// appendValue appends encoded value of the field to buffer.
+func (f Field) appendValue(buf []byte) []byte {
+	switch f.kind {
+	case stringKind:
+		return append(buf, f.s...)
+	case intKind:
+		return strconv.AppendInt(buf, f.i, 10)
+	case uintKind:
+		return strconv.AppendUint(buf, uint64(f.i), 10)
+	case floatKind:
+		// float32 values are marked with bit size, to avoid noise digits
+		return strconv.AppendFloat(buf, math.Float64frombits(uint64(f.i)), 'g', -1, int(f.n))
+	case boolKind:
+		return strconv.AppendBool(buf, f.i == 1)
+	case durationKind:
+		return append(buf, time.Duration(f.i).String()...)
+	case timeKind:
+		t := time.Unix(f.i, int64(f.n)).In(f.v.(*time.Location))
+		return t.AppendFormat(buf, time.RFC3339Nano)
+	case errorKind:
+		if f.v == nil {
+			return append(buf, "<nil>"...)
+		}
+		return append(buf, f.v.(error).Error()...)
+	default:
+		return append(buf, fmt.Sprintf("%v", f.v)...)
+	}
+}
+
+// fields converts map tags to fields, sorted by key.
+func (tags Tags) fields() []Field {
+	if len(tags) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]Field, 0, len(tags))
+	for _, k := range keys {
+		fields = append(fields, Any(k, tags[k]))
+	}
+	return fields
+}
+
+// stringTags encodes fields as string tags of a log. Fields added later
+// overwrite the earlier ones with same key.
+func stringTags(fields []Field) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	tags := make(map[string]string, len(fields))
+	var buf []byte
+	for _, f := range fields {
+		buf = f.appendValue(buf[:0])
+		tags[f.key] = string(buf)
+	}
+	return tags
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var benchTime = time.Date(2018, 10, 1, 12, 30, 0, 500, time.UTC)
+
+func BenchmarkFieldTags(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stringTags([]Field{
+			Str("user", "u1"),
+			Int("n", i),
+			Float("ratio", 0.5),
+			Bool("ok", true),
+			Dur("took", time.Second),
+			Time("at", benchTime),
+			Err(errors.New("failed")),
+		})
+	}
+}
+
+func BenchmarkMapTags(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		stringTags(Tags{
+			"user":  "u1",
+			"n":     i,
+			"ratio": 0.5,
+			"ok":    true,
+			"took":  time.Second,
+			"at":    benchTime,
+			"error": errors.New("failed"),
+		}.fields())
+	}
+}
+
+func TestFieldString(t *testing.T) {
+	loc := time.FixedZone("X", 3600)
+	tests := []struct {
+		field Field
+		want  string
+	}{
+		{Str("k", "v"), "v"},
+		{Int("k", -3), "-3"},
+		{Uint64("k", 1<<63), "9223372036854775808"},
+		{Float("k", 0.1), "0.1"},
+		{Any("k", float32(0.1)), "0.1"},
+		{Bool("k", true), "true"},
+		{Dur("k", 1500*time.Millisecond), "1.5s"},
+		{Time("k", benchTime), "2018-10-01T12:30:00.0000005Z"},
+		{Time("k", benchTime.In(loc)), "2018-10-01T13:30:00.0000005+01:00"},
+		{Time("k", time.Time{}), "0001-01-01T00:00:00Z"},
+		{Err(nil), "<nil>"},
+		{Any("k", []int{1}), "[1]"},
+	}
+	for _, test := range tests {
+		if got := test.field.String(); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.field.kind, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package log
+
+// Print logs to a local file, rotated by size and age.
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/blitzlog/errors"
+	"github.com/blitzlog/proto/log"
+)
+
+// backupTimeFormat is the timestamp suffix of rotated files, sorts by time.
+const backupTimeFormat = "20060102T150405.000"
+
+// FileConfig configures a file sink.
+type FileConfig struct {
+	Path       string        // path of log file
+	MaxSize    int64         // rotate when file grows past bytes, 0 to disable
+	MaxAge     time.Duration // rotate when file is open longer, 0 to disable
+	MaxBackups int           // files rotated by sink to keep, 0 to keep all
+	Compress   bool          // gzip rotated files
+	JSON       bool          // print logs as json
+	Formatter  Formatter     // formats logs, overriding JSON, if set
+}
+
+// FileSink prints logs to a file, rotating it by size and age. File is
+// reopened on SIGHUP, to work with external log rotation.
+type FileSink struct {
+	conf     FileConfig
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+	wg       sync.WaitGroup // compressing backups
+	bgMu     sync.Mutex     // compressing and pruning backups, one at a time
+	bgErr    error          // error compressing backups, reported on flush
+	sighup   chan os.Signal
+	done     chan bool
+}
+
+// NewFileSink opens file for appending logs.
+//   sink, err := log.NewFileSink(log.FileConfig{Path: "/var/log/app.log"})
+//   log.AddSink(sink)
+func NewFileSink(conf FileConfig) (*FileSink, error) {
+	s := &FileSink{
+		conf:   conf,
+		sighup: make(chan os.Signal, 1),
+		done:   make(chan bool),
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	// reopen file on hangup
+	signal.Notify(s.sighup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-s.sighup:
+				// report error via logger on next flush
+				if err := s.Reopen(); err != nil {
+					s.mu.Lock()
+					s.bgErr = err
+					s.mu.Unlock()
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+// Write prints log to file, rotating it if needed.
+func (s *FileSink) Write(lg *log.Log) error {
+	return s.WriteEntry(NewEntry(lg))
+}
+
+// WriteEntry prints log entry to file, rotating it if needed.
+func (s *FileSink) WriteEntry(e *Entry) error {
+	f := s.conf.Formatter
+	if f == nil {
+		f = TextFormatter
+		if s.conf.JSON {
+			f = defaultJSON
+		}
+	}
+	line := append(formatEntry(f, e, nil), '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("file sink closed: %s", s.conf.Path)
+	}
+
+	// retry opening file, after it failed to open on rotation
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	if s.rotateDue(int64(len(line))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "error writing log file")
+	}
+	return nil
+}
+
+// outputFile returns file being written, nil if closed.
+func (s *FileSink) outputFile() *os.File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file
+}
+
+// Flush syncs file to disk, and reports errors compressing backups.
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// report background errors via logger
+	if s.bgErr != nil {
+		err := s.bgErr
+		s.bgErr = nil
+		return err
+	}
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+// Close stops watching hangup, closes file and waits for backups to be
+// compressed.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	signal.Stop(s.sighup)
+	close(s.done)
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// Reopen closes and reopens file at the same path, used after file has
+// been moved by external log rotation.
+func (s *FileSink) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	return s.open()
+}
+
+// Rotate moves current file to a backup, and opens a new file.
+func (s *FileSink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	return s.rotate()
+}
+
+// rotateDue checks if file is to be rotated before writing given bytes.
+func (s *FileSink) rotateDue(n int64) bool {
+	if s.conf.MaxSize > 0 && s.size > 0 && s.size+n > s.conf.MaxSize {
+		return true
+	}
+	if s.conf.MaxAge > 0 && time.Since(s.openedAt) >= s.conf.MaxAge {
+		return true
+	}
+	return false
+}
+
+// open opens file for appending, creating it and its directory if needed.
+func (s *FileSink) open() error {
+	err := os.MkdirAll(filepath.Dir(s.conf.Path), 0755)
+	if err != nil {
+		return errors.Wrap(err, "error creating log directory")
+	}
+
+	f, err := os.OpenFile(s.conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "error opening log file")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "error reading log file")
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.openedAt = time.Now()
+	return nil
+}
+
+// rotate closes file, moves it to backup, and opens a new file. If file
+// fails to open, it is left closed, and opened again on next write.
+func (s *FileSink) rotate() error {
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+
+	backup := s.backupPath()
+	if err := os.Rename(s.conf.Path, backup); err != nil {
+		err = errors.Wrap(err, "error moving log file")
+		// keep logging to the same file
+		if oerr := s.open(); oerr != nil {
+			return errors.New("%v; %v", err, oerr)
+		}
+		return err
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	// compress and prune backups in background, pruning never sees a
+	// backup both as original and compressed
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.bgMu.Lock()
+		defer s.bgMu.Unlock()
+		if s.conf.Compress {
+			if err := compressFile(backup); err != nil {
+				s.mu.Lock()
+				s.bgErr = errors.Wrap(err, "error compressing "+backup)
+				s.mu.Unlock()
+			}
+		}
+		s.prune()
+	}()
+
+	return nil
+}
+
+// backupPath returns a free path to move file to, with timestamp suffix,
+// and a sequence number if rotated more than once in a millisecond.
+func (s *FileSink) backupPath() string {
+	base := s.conf.Path + "." + time.Now().UTC().Format(backupTimeFormat)
+	backup := base
+	for i := 1; backupExists(backup); i++ {
+		backup = fmt.Sprintf("%s-%03d", base, i)
+	}
+	return backup
+}
+
+// backupExists checks if backup exists, compressed or not.
+func backupExists(path string) bool {
+	for _, p := range []string{path, path + ".gz", path + ".gz.tmp"} {
+		if _, err := os.Lstat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isBackup checks if path is a backup rotated by sink, named as by
+// backupPath, compressed or not.
+func (s *FileSink) isBackup(path string) bool {
+	suffix := strings.TrimPrefix(path, s.conf.Path+".")
+	if suffix == path {
+		return false
+	}
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	if len(suffix) > len(backupTimeFormat) {
+		seq := suffix[len(backupTimeFormat):]
+		if len(seq) < 4 || seq[0] != '-' {
+			return false
+		}
+		for _, c := range seq[1:] {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+		suffix = suffix[:len(backupTimeFormat)]
+	}
+	_, err := time.Parse(backupTimeFormat, suffix)
+	return err == nil
+}
+
+// prune removes oldest backups beyond max backups.
+func (s *FileSink) prune() {
+	if s.conf.MaxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(s.conf.Path + ".*")
+	if err != nil {
+		return
+	}
+
+	// skip partially compressed files, and files not rotated by sink, such
+	// as lock files, or backups of external logrotate
+	var names []string
+	for _, b := range backups {
+		if s.isBackup(b) {
+			names = append(names, b)
+		}
+	}
+
+	// timestamp and sequence suffix sorts oldest first
+	sort.Slice(names, func(i, j int) bool {
+		return strings.TrimSuffix(names[i], ".gz") < strings.TrimSuffix(names[j], ".gz")
+	})
+	for len(names) > s.conf.MaxBackups {
+		os.Remove(names[0])
+		names = names[1:]
+	}
+}
+
+// compressFile gzips file to file.gz, and removes the original.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
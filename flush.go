@@ -1,37 +1,181 @@
 package log
 
 import (
+	"context"
 	"fmt"
-	"runtime/debug"
+	"sync"
 	"time"
-
-	"github.com/blitzlog/proto/log"
 )
 
-// Flush all logs sent so far.
+// defaultFlushTimeout bounds time taken by Flush.
+const defaultFlushTimeout = 5 * time.Second
+
+// FlushError reports logs not delivered when flush returned.
+type FlushError struct {
+	Undelivered int64 // logs not delivered
+	Err         error // reason, such as context deadline
+}
+
+func (e *FlushError) Error() string {
+	return fmt.Sprintf("flush: %d logs undelivered: %v", e.Undelivered, e.Err)
+}
+
+// Unwrap returns reason of flush error.
+func (e *FlushError) Unwrap() error {
+	return e.Err
+}
+
+// contextFlusher is implemented by sinks that flush within a context.
+type contextFlusher interface {
+	FlushContext(ctx context.Context) error
+}
+
+// Flush all logs sent so far via default logger.
 func Flush() {
+	// recover must be called directly by the deferred function
+	if r := recover(); r != nil {
+		std.HandlePanic(r)
+		return
+	}
+	std.flush()
+}
 
-	// flush stdout
-	time.Sleep(time.Millisecond)
-	l.stdout.Sync()
-
-	// if we are emitting logs, then get stack trace
-	onlyLocal := l.conf.apiKey == "" || l.conf.apiError
-	if !onlyLocal {
-		r := recover()
-		if r != nil {
-			stack := debug.Stack()
-			mux(&log.Log{
-				Timestamp: time.Now().UTC().UnixNano() / 1e6,
-				Raw:       fmt.Sprintf("%s\n%s", r, stack),
-			})
-		}
+// Flush all logs sent so far, waiting up to a few seconds for them to be
+// delivered. Errors are reported as internal errors. If deferred while
+// panicking, the panic is handled as Recover does, so it is published and
+// then continues or exits as per panic mode.
+func (l *Logger) Flush() {
+	// recover must be called directly by the deferred function
+	if r := recover(); r != nil {
+		l.HandlePanic(r)
+		return
+	}
+	l.flush()
+}
+
+// FlushContext flushes all logs sent so far via default logger.
+func FlushContext(ctx context.Context) error {
+	return std.FlushContext(ctx)
+}
+
+// FlushContext flushes all logs sent so far, and waits till they are
+// delivered or context is done. If logs are not delivered, it returns
+// *FlushError with count of undelivered logs.
+func (l *Logger) FlushContext(ctx context.Context) error {
+	return l.flushContext(ctx)
+}
+
+// emitting checks if logs are being sent to edge.
+func (l *Logger) emitting() bool {
+	return l.getAPIKey() != "" && !l.conf.apiError
+}
+
+// flush all sinks in bounded time.
+func (l *Logger) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultFlushTimeout)
+	defer cancel()
+	if err := l.flushContext(ctx); err != nil {
+		l.internalError(&InternalError{Stage: StageSink, Err: err})
 	}
+}
+
+// flushContext flushes all sinks.
+func (l *Logger) flushContext(ctx context.Context) error {
 
 	// flush logs
 	time.Sleep(time.Millisecond)
-	l.flushChannel <- true
+	var firstErr error
+	for _, sink := range l.getSinks() {
+		var err error
+		if f, ok := sink.(contextFlusher); ok {
+			err = f.FlushContext(ctx)
+		} else {
+			err = sink.Flush()
+		}
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*FlushError); !ok {
+			l.internalError(&InternalError{Stage: StageSink, Err: err})
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// pending counts logs pushed to edge and logs delivered, so flush waits for
+// logs pushed before it, and not for logs pushed while waiting.
+type pending struct {
+	mu        sync.Mutex
+	pushed    int64 // logs pushed
+	delivered int64 // logs delivered
+	waiters   []*flushWaiter
+}
+
+// flushWaiter waits till given count of logs is delivered.
+type flushWaiter struct {
+	target int64
+	ready  chan struct{}
+}
+
+// add counts logs pushed.
+func (p *pending) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pushed += n
+}
 
-	// wait to process all logs
-	l.wg.Wait()
+// done counts logs delivered, or otherwise taken care of, and wakes up
+// flushes waiting for them.
+func (p *pending) done(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.delivered += n
+	if p.delivered > p.pushed {
+		p.delivered = p.pushed
+	}
+	waiters := p.waiters[:0]
+	for _, w := range p.waiters {
+		if w.target <= p.delivered {
+			close(w.ready)
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	p.waiters = waiters
+}
+
+// wait waits till logs pending at time of call are delivered, or context
+// is done.
+func (p *pending) wait(ctx context.Context) error {
+	p.mu.Lock()
+	if p.delivered >= p.pushed {
+		p.mu.Unlock()
+		return nil
+	}
+	w := &flushWaiter{target: p.pushed, ready: make(chan struct{})}
+	p.waiters = append(p.waiters, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, pw := range p.waiters {
+		if pw == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			break
+		}
+	}
+	undelivered := w.target - p.delivered
+	if undelivered <= 0 {
+		return nil
+	}
+	return &FlushError{Undelivered: undelivered, Err: ctx.Err()}
 }
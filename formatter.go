@@ -0,0 +1,195 @@
+package log
+
+// Format logs via pluggable formatters and templates.
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/blitzlog/errors"
+	"github.com/blitzlog/proto/log"
+)
+
+// Formatter formats logs printed by sinks, such as stdout and file sinks.
+type Formatter interface {
+	// Format appends formatted log to buf, without a trailing newline.
+	Format(lg *log.Log, buf []byte) []byte
+}
+
+// EntryFormatter is a formatter of log entries, with tags in order and
+// global tags. Formatters not implementing it are given logs, with tags of
+// the line only.
+type EntryFormatter interface {
+	Formatter
+	// FormatEntry appends formatted log entry to buf, without a trailing
+	// newline.
+	FormatEntry(e *Entry, buf []byte) []byte
+}
+
+// formatEntry formats entry via formatter, as entry if formatter takes
+// entries, else as log.
+func formatEntry(f Formatter, e *Entry, buf []byte) []byte {
+	if ef, ok := f.(EntryFormatter); ok {
+		return ef.FormatEntry(e, buf)
+	}
+	return f.Format(e.Log, buf)
+}
+
+// FormatterFunc adapts a function to Formatter.
+type FormatterFunc func(lg *log.Log, buf []byte) []byte
+
+// Format calls f.
+func (f FormatterFunc) Format(lg *log.Log, buf []byte) []byte {
+	return f(lg, buf)
+}
+
+// TextFormatter formats logs in concise human readable format, as Format.
+var TextFormatter Formatter = textFormatter{}
+
+// textFormatter formats logs as Format.
+type textFormatter struct{}
+
+// Format appends log formatted as Format to buf.
+func (textFormatter) Format(lg *log.Log, buf []byte) []byte {
+	return append(buf, Format(lg)...)
+}
+
+// FormatEntry appends log entry formatted as Format to buf.
+func (textFormatter) FormatEntry(e *Entry, buf []byte) []byte {
+	return append(buf, formatText(e)...)
+}
+
+// formatterValue boxes formatter, as atomic.Value does not store nil.
+type formatterValue struct {
+	Formatter
+}
+
+// SetFormatter sets formatter of default logger.
+func SetFormatter(f Formatter) {
+	std.SetFormatter(f)
+}
+
+// SetFormatter sets formatter of logs printed to stdout, overriding local
+// format. Setting local format, such as via JSON, resets it.
+//
+//	f, err := log.Template("{{.Time}} [{{.Level}}] {{.File}}:{{.Line}} {{.Msg}} {{.Tags}}")
+//	log.SetFormatter(f)
+func (l *Logger) SetFormatter(f Formatter) {
+	l.conf.formatter.Store(formatterValue{f})
+}
+
+// getFormatter returns formatter of logs printed to stdout.
+func (l *Logger) getFormatter() Formatter {
+	if v, _ := l.conf.formatter.Load().(formatterValue); v.Formatter != nil {
+		return v.Formatter
+	}
+	switch l.conf.logFormat {
+	case FormatJSON:
+		return l.getJSON()
+	case FormatLogfmt:
+		return defaultLogfmt
+	case FormatConsole:
+		return l.getConsole()
+	}
+	return TextFormatter
+}
+
+// setLocalFormat sets local format, resetting formatter.
+func (l *Logger) setLocalFormat(format string) {
+	l.conf.logFormat = format
+	l.conf.formatter.Store(formatterValue{})
+}
+
+// TemplateLog is the data a template formats. Time prints as RFC 3339 in
+// UTC, and Tags as space separated key=value pairs, in order of entry.
+type TemplateLog struct {
+	Time      TemplateTime
+	Level     string // level name, "raw" for raw logs
+	File      string
+	Line      int32
+	Function  string
+	Verbosity int32
+	Msg       string
+	Raw       string
+	Tags      EntryTags
+}
+
+// TemplateTime is time of a log. It may be formatted in a template, such
+// as with {{.Time.Local.Format "15:04:05"}}.
+type TemplateTime struct {
+	time.Time
+}
+
+// String formats time as RFC 3339 in UTC.
+func (t TemplateTime) String() string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// templateFormatter formats logs via a template, reporting errors to
+// logger.
+type templateFormatter struct {
+	l    *Logger
+	tmpl *template.Template
+}
+
+// Template returns formatter formatting logs via a template, reporting
+// errors to default logger.
+func Template(format string) (Formatter, error) {
+	return std.Template(format)
+}
+
+// Template returns formatter formatting logs via a text/template, executed
+// on TemplateLog. Logs the template fails to format are formatted as by
+// Format, and the error is reported as an internal error at StageFormat.
+//
+//	log.Template("{{.Time}} [{{.Level}}] {{.File}}:{{.Line}} {{.Msg}} {{.Tags}}")
+func (l *Logger) Template(format string) (Formatter, error) {
+	tmpl, err := template.New("log").Parse(format)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing log template")
+	}
+	return &templateFormatter{l, tmpl}, nil
+}
+
+// Format appends log formatted via template to buf.
+func (f *templateFormatter) Format(lg *log.Log, buf []byte) []byte {
+	return f.FormatEntry(NewEntry(lg), buf)
+}
+
+// FormatEntry appends log entry formatted via template to buf.
+func (f *templateFormatter) FormatEntry(e *Entry, buf []byte) []byte {
+	lg := e.Log
+	data := &TemplateLog{
+		Time:      TemplateTime{e.time()},
+		Level:     levelName(lg.Level),
+		File:      lg.GetFile(),
+		Line:      lg.GetLine(),
+		Function:  lg.GetFunction(),
+		Verbosity: lg.GetVerbosity(),
+		Msg:       lg.GetMsg(),
+		Raw:       lg.GetRaw(),
+		Tags:      e.Tags,
+	}
+	w := &appendWriter{buf}
+	if err := f.tmpl.Execute(w, data); err != nil {
+		f.l.internalError(&InternalError{Stage: StageFormat, Err: err})
+		return textFormatter{}.FormatEntry(e, buf)
+	}
+	return w.buf
+}
+
+// appendWriter appends writes to a buffer.
+type appendWriter struct {
+	buf []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+// isTemplate checks if format is a template, rather than a format name.
+func isTemplate(format string) bool {
+	return strings.Contains(format, "{{")
+}
@@ -0,0 +1,397 @@
+package log
+
+// Log gRPC calls via interceptors.
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blitzlog/errors"
+	"github.com/blitzlog/proto/log"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Tags of gRPC call logs.
+const (
+	GRPCMethodKey   = "grpc.method"     // full method, /service/method
+	GRPCPeerKey     = "grpc.peer"       // address of peer
+	GRPCCodeKey     = "grpc.code"       // status code
+	GRPCLatencyKey  = "grpc.latency"    // duration of call
+	GRPCSentKey     = "grpc.sent_bytes" // size of messages sent
+	GRPCRecvKey     = "grpc.recv_bytes" // size of messages received
+	GRPCSentMsgsKey = "grpc.sent_msgs"  // messages sent on stream
+	GRPCRecvMsgsKey = "grpc.recv_msgs"  // messages received on stream
+)
+
+// prefixes of gRPC call log messages, followed by method.
+const (
+	grpcServerPrefix = "grpc server "
+	grpcClientPrefix = "grpc client "
+)
+
+// grpcFrames are prefixes of functions between a client call and its log,
+// skipped to attribute the log to the client stub making the call.
+var grpcFrames = []string{
+	funcPackage(New),
+	strings.TrimSuffix(funcPackage(grpc.Dial), ".") + "/",
+	funcPackage(grpc.Dial),
+	"sync.",
+}
+
+// GRPCConfig configures gRPC interceptors.
+type GRPCConfig struct {
+	// Levels sets level of call log per status code, from "debug" to
+	// "error", overriding defaults. By default, OK is info, client errors
+	// such as InvalidArgument are warn, and others are error.
+	Levels map[codes.Code]string
+
+	// Exclude lists full methods not logged, such as health checks.
+	Exclude []string
+}
+
+// Validate checks that levels are known, and not fatal, as fatal logs
+// panic. Interceptors panic on creation if config is not valid.
+func (conf *GRPCConfig) Validate() error {
+	_, err := conf.levels()
+	return err
+}
+
+// levels parses levels per status code.
+func (conf *GRPCConfig) levels() (grpcLevels, error) {
+	levels := make(grpcLevels, len(conf.Levels))
+	for code, level := range conf.Levels {
+		lvl, err := parseCallLevel(level)
+		if err != nil {
+			return nil, errors.Wrap(err, "gRPC level of "+code.String())
+		}
+		levels[code] = lvl
+	}
+	return levels, nil
+}
+
+// mustLevels parses levels per status code, panicking if not valid.
+func (conf *GRPCConfig) mustLevels() grpcLevels {
+	levels, err := conf.levels()
+	if err != nil {
+		panic("log: invalid GRPCConfig: " + err.Error())
+	}
+	return levels
+}
+
+// grpcLevels is level of call log per status code, overriding defaults.
+type grpcLevels map[codes.Code]log.Level
+
+// level returns level of call log for status code.
+func (levels grpcLevels) level(code codes.Code) log.Level {
+	if level, ok := levels[code]; ok {
+		return level
+	}
+	switch code {
+	case codes.OK:
+		return log.Level_info
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound,
+		codes.AlreadyExists, codes.PermissionDenied, codes.Unauthenticated,
+		codes.ResourceExhausted, codes.FailedPrecondition, codes.Aborted,
+		codes.OutOfRange:
+		return log.Level_warn
+	}
+	return log.Level_error
+}
+
+// excluded checks if method is not logged.
+func (conf *GRPCConfig) excluded(method string) bool {
+	for _, m := range conf.Exclude {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// UnaryServerInterceptor logs unary calls via default logger.
+func UnaryServerInterceptor(conf GRPCConfig) grpc.UnaryServerInterceptor {
+	return std.UnaryServerInterceptor(conf)
+}
+
+// UnaryServerInterceptor logs each unary call served, once done. Handler
+// context carries tags of the call, for logging via Ctx. It panics if conf
+// is not valid.
+//
+//	grpc.NewServer(grpc.UnaryInterceptor(log.UnaryServerInterceptor(conf)))
+func (l *Logger) UnaryServerInterceptor(conf GRPCConfig) grpc.UnaryServerInterceptor {
+	levels := conf.mustLevels()
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		if conf.excluded(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		vtags := l.grpcServerTags(ctx, info.FullMethod)
+		resp, err := handler(NewContext(ctx, vtags), req)
+
+		code := status.Code(err)
+		vtags.logAt(0, levels.level(code), []Field{
+			Str(GRPCCodeKey, code.String()),
+			Dur(GRPCLatencyKey, time.Since(start)),
+			Int(GRPCRecvKey, messageSize(req)),
+			Int(GRPCSentKey, messageSize(resp)),
+		}, grpcServerPrefix+info.FullMethod)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor logs streams via default logger.
+func StreamServerInterceptor(conf GRPCConfig) grpc.StreamServerInterceptor {
+	return std.StreamServerInterceptor(conf)
+}
+
+// StreamServerInterceptor logs each stream served, once done, with count
+// and size of messages. Stream context carries tags of the call. It panics
+// if conf is not valid.
+func (l *Logger) StreamServerInterceptor(conf GRPCConfig) grpc.StreamServerInterceptor {
+	levels := conf.mustLevels()
+	return func(srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		if conf.excluded(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		start := time.Now()
+		vtags := l.grpcServerTags(ss.Context(), info.FullMethod)
+		stream := &serverStream{
+			ServerStream: ss,
+			ctx:          NewContext(ss.Context(), vtags),
+		}
+		err := handler(srv, stream)
+
+		code := status.Code(err)
+		vtags.logAt(0, levels.level(code), append([]Field{
+			Str(GRPCCodeKey, code.String()),
+			Dur(GRPCLatencyKey, time.Since(start)),
+		}, stream.counts.fields()...), grpcServerPrefix+info.FullMethod)
+		return err
+	}
+}
+
+// UnaryClientInterceptor logs unary calls via default logger.
+func UnaryClientInterceptor(conf GRPCConfig) grpc.UnaryClientInterceptor {
+	return std.UnaryClientInterceptor(conf)
+}
+
+// UnaryClientInterceptor logs each unary call made, once done, with tags
+// carried by call context. It panics if conf is not valid.
+//
+//	grpc.Dial(address, grpc.WithUnaryInterceptor(log.UnaryClientInterceptor(conf)))
+func (l *Logger) UnaryClientInterceptor(conf GRPCConfig) grpc.UnaryClientInterceptor {
+	levels := conf.mustLevels()
+	return func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+		if conf.excluded(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		start := time.Now()
+		var p peer.Peer
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+
+		code := status.Code(err)
+		fields := []Field{
+			Str(GRPCMethodKey, method),
+			Str(GRPCPeerKey, peerAddress(&p)),
+			Str(GRPCCodeKey, code.String()),
+			Dur(GRPCLatencyKey, time.Since(start)),
+			Int(GRPCSentKey, messageSize(req)),
+		}
+		if err == nil {
+			fields = append(fields, Int(GRPCRecvKey, messageSize(reply)))
+		}
+		l.Ctx(ctx).logAt(callerDepth(grpcFrames), levels.level(code), fields,
+			grpcClientPrefix+method)
+		return err
+	}
+}
+
+// StreamClientInterceptor logs streams via default logger.
+func StreamClientInterceptor(conf GRPCConfig) grpc.StreamClientInterceptor {
+	return std.StreamClientInterceptor(conf)
+}
+
+// StreamClientInterceptor logs each stream opened, once done, i.e. once a
+// receive fails or returns io.EOF, or the single response of a client
+// stream is received. It panics if conf is not valid.
+func (l *Logger) StreamClientInterceptor(conf GRPCConfig) grpc.StreamClientInterceptor {
+	levels := conf.mustLevels()
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+
+		if conf.excluded(method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		stream := &clientStream{
+			vtags:   l.Ctx(ctx),
+			levels:  levels,
+			method:  method,
+			streams: desc.ServerStreams,
+			start:   time.Now(),
+		}
+		cs, err := streamer(ctx, desc, cc, method, append(opts, grpc.Peer(&stream.peer))...)
+		if err != nil {
+			stream.done(err)
+			return nil, err
+		}
+		stream.ClientStream = cs
+		return stream, nil
+	}
+}
+
+// grpcServerTags returns tags of call served, with logger's verbosity.
+func (l *Logger) grpcServerTags(ctx context.Context, method string) *VTags {
+	var address string
+	if p, ok := peer.FromContext(ctx); ok {
+		address = peerAddress(p)
+	}
+	return &VTags{l, defaultVerbosity, []Field{
+		Str(GRPCMethodKey, method),
+		Str(GRPCPeerKey, address),
+	}}
+}
+
+// peerAddress returns address of peer, if known.
+func peerAddress(p *peer.Peer) string {
+	if p.Addr == nil {
+		return ""
+	}
+	return p.Addr.String()
+}
+
+// messageSize returns encoded size of proto message, 0 if not a proto.
+func messageSize(msg interface{}) int {
+	if m, ok := msg.(proto.Message); ok {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+// streamCounts counts messages and bytes sent and received on a stream.
+type streamCounts struct {
+	mu                   sync.Mutex
+	sentMsgs, recvMsgs   int
+	sentBytes, recvBytes int
+}
+
+func (c *streamCounts) sent(msg interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sentMsgs++
+	c.sentBytes += messageSize(msg)
+}
+
+func (c *streamCounts) recv(msg interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.recvMsgs++
+	c.recvBytes += messageSize(msg)
+}
+
+func (c *streamCounts) fields() []Field {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return []Field{
+		Int(GRPCSentMsgsKey, c.sentMsgs),
+		Int(GRPCSentKey, c.sentBytes),
+		Int(GRPCRecvMsgsKey, c.recvMsgs),
+		Int(GRPCRecvKey, c.recvBytes),
+	}
+}
+
+// serverStream counts messages of stream served, and carries call tags in
+// its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	counts streamCounts
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.counts.sent(m)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.counts.recv(m)
+	}
+	return err
+}
+
+// clientStream counts messages of stream opened, and logs it once done.
+type clientStream struct {
+	grpc.ClientStream
+	vtags   *VTags
+	levels  grpcLevels
+	method  string
+	streams bool // server streams responses
+	start   time.Time
+	peer    peer.Peer
+	counts  streamCounts
+	once    sync.Once
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.counts.sent(m)
+	} else if err != io.EOF {
+		s.done(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.done(nil)
+	case err != nil:
+		s.done(err)
+	default:
+		s.counts.recv(m)
+		if !s.streams {
+			s.done(nil)
+		}
+	}
+	return err
+}
+
+// done logs stream, once.
+func (s *clientStream) done(err error) {
+	s.once.Do(func() {
+		code := status.Code(err)
+		s.vtags.logAt(callerDepth(grpcFrames), s.levels.level(code), append([]Field{
+			Str(GRPCMethodKey, s.method),
+			Str(GRPCPeerKey, peerAddress(&s.peer)),
+			Str(GRPCCodeKey, code.String()),
+			Dur(GRPCLatencyKey, time.Since(s.start)),
+		}, s.counts.fields()...), grpcClientPrefix+s.method)
+	})
+}
@@ -0,0 +1,242 @@
+package log
+
+// Log HTTP requests via middleware.
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/blitzlog/errors"
+	"github.com/blitzlog/proto/log"
+)
+
+// Tags of HTTP request logs.
+const (
+	HTTPMethodKey    = "http.method"     // request method
+	HTTPPathKey      = "http.path"       // request path
+	HTTPStatusKey    = "http.status"     // response status
+	HTTPBytesKey     = "http.bytes"      // response body size
+	HTTPDurationKey  = "http.duration"   // time to serve request
+	HTTPRemoteKey    = "http.remote"     // remote address
+	HTTPUserAgentKey = "http.user_agent" // user agent
+	HTTPRequestIDKey = "http.request_id" // request id
+)
+
+// DefaultRequestIDHeader is the default header carrying request id.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// httpMessage is the message of request logs. It is the same for all
+// requests, as edge groups logs by message, and path is tagged.
+const httpMessage = "http request"
+
+// maxRequestID is the max length of request id taken from request.
+const maxRequestID = 128
+
+// HTTPConfig configures HTTP middleware.
+type HTTPConfig struct {
+	// Levels sets level of request log per status class, such as "info"
+	// for 4, i.e. 4xx, overriding defaults. By default, 1xx to 3xx are
+	// info, 4xx are warn and 5xx are error.
+	Levels map[int]string
+
+	// RequestIDHeader is the header carrying request id, taken from request
+	// if set, else generated, and set on response. DefaultRequestIDHeader
+	// if empty.
+	RequestIDHeader string
+
+	// Exclude lists paths not logged, such as health checks.
+	Exclude []string
+}
+
+// Validate checks that levels are known, and not fatal, as fatal logs
+// panic. Middleware panics on creation if config is not valid.
+func (conf *HTTPConfig) Validate() error {
+	_, err := conf.levels()
+	return err
+}
+
+// levels parses levels per status class.
+func (conf *HTTPConfig) levels() (httpLevels, error) {
+	levels := make(httpLevels, len(conf.Levels))
+	for class, level := range conf.Levels {
+		lvl, err := parseCallLevel(level)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("HTTP level of %dxx", class))
+		}
+		levels[class] = lvl
+	}
+	return levels, nil
+}
+
+// httpLevels is level of request log per status class, overriding defaults.
+type httpLevels map[int]log.Level
+
+// level returns level of request log for status.
+func (levels httpLevels) level(status int) log.Level {
+	class := status / 100
+	if level, ok := levels[class]; ok {
+		return level
+	}
+	switch {
+	case class >= 5:
+		return log.Level_error
+	case class == 4:
+		return log.Level_warn
+	}
+	return log.Level_info
+}
+
+// excluded checks if path is not logged.
+func (conf *HTTPConfig) excluded(path string) bool {
+	for _, p := range conf.Exclude {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPMiddleware logs HTTP requests via default logger.
+func HTTPMiddleware(conf HTTPConfig) func(http.Handler) http.Handler {
+	return std.HTTPMiddleware(conf)
+}
+
+// HTTPMiddleware returns middleware logging each request once served,
+// tagged with method, path, status, bytes, duration, remote address, user
+// agent and request id. Request context carries tags of the request, so
+// handlers may log with them via Ctx. Requests whose handler panics are
+// logged with status 500, and the panic continues. It panics if conf is not
+// valid.
+//
+//	http.ListenAndServe(":8080", log.HTTPMiddleware(log.HTTPConfig{})(mux))
+func (l *Logger) HTTPMiddleware(conf HTTPConfig) func(http.Handler) http.Handler {
+	levels, err := conf.levels()
+	if err != nil {
+		panic("log: invalid HTTPConfig: " + err.Error())
+	}
+	header := conf.RequestIDHeader
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if conf.excluded(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+
+			// propagate request id, or generate one if missing or not
+			// a short printable token
+			id := r.Header.Get(header)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(header, id)
+
+			vtags := &VTags{l, defaultVerbosity, []Field{
+				Str(HTTPMethodKey, r.Method),
+				Str(HTTPPathKey, r.URL.Path),
+				Str(HTTPRequestIDKey, id),
+			}}
+			rw := &responseWriter{ResponseWriter: w}
+
+			// log once served, also if handler panics
+			served := false
+			defer func() {
+				status := rw.status
+				if status == 0 {
+					status = http.StatusOK
+					if !served {
+						status = http.StatusInternalServerError
+					}
+				}
+				vtags.logAt(0, levels.level(status), []Field{
+					Int(HTTPStatusKey, status),
+					Int64(HTTPBytesKey, rw.bytes),
+					Dur(HTTPDurationKey, time.Since(start)),
+					Str(HTTPRemoteKey, r.RemoteAddr),
+					Str(HTTPUserAgentKey, r.UserAgent()),
+				}, httpMessage)
+			}()
+
+			next.ServeHTTP(rw, r.WithContext(NewContext(r.Context(), vtags)))
+			served = true
+		})
+	}
+}
+
+// validRequestID checks if request id is set, at most maxRequestID long,
+// and of printable ASCII without spaces, so it is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request id.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// responseWriter records status and size of response.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush flushes response, if supported.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks connection, if supported.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijack")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns underlying response writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -1,8 +1,10 @@
 package log
 
 import (
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 
 	"github.com/blitzlog/proto/log"
 )
@@ -11,27 +13,64 @@ const version = "0.0.0"
 
 // init routines to manage log processing.
 func init() {
-	l.tags = newTags()
-	l.conf = defaultConfig()
-	l.errFile, _ = os.Create("/tmp/blitz.log")
-	l.stdout = os.Stdout
+	std = New()
 
-	// init channels
-	l.edgeChannel = make(chan *log.Log, 1000)
-	l.flushChannel = make(chan bool, 1)
-
-	// TODO: enable configurable stdout redirect
-	//redirect() // redirect logs from stdout
+	// configure default logger from environment
+	if err := std.LoadEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "log: %v\n", err)
+	}
 }
 
-type logging struct {
+// Logger publishes logs to stdout and/or edge server. Each logger has its
+// own config, global tags, edge connection and flush group, so loggers may
+// be used side by side without touching each other's state.
+type Logger struct {
+	dropped      int64 // logs dropped on overflow, first for alignment
 	conf         *config
-	wg           sync.WaitGroup
-	stdout       *os.File
-	errFile      *os.File
+	pending      pending      // logs pushed to edge, not yet delivered
+	stdout       atomic.Value // *os.File, original stdout while captured
+	diag         diagnostics
 	tags         *tags
 	edgeChannel  chan *log.Log // channel to push logs to edge
 	flushChannel chan bool     // channel to flush logs
+	senderMu     sync.Mutex
+	daemon       *senderDaemon // running sender daemon, nil if none
+	sinksMu      sync.RWMutex
+	sinks        []Sink       // sinks to publish logs
+	stdoutSink   Sink         // default sink to print logs
+	edgeSink     Sink         // default sink to send logs to edge
+	vmodule      atomic.Value // *vmodule, verbosity per call site
+	samplerMu    sync.Mutex
+	sampler      atomic.Value // *sampler, sampling per call site
+	spool        atomic.Value // *spool, logs spooled while edge is down
+	captureMu    sync.Mutex
+	captures     []*capture // stdout and stderr captures
+}
+
+// New creates a logger with default config, printing logs to stdout and
+// sending them to edge once API key is set. Logs are printed in console
+// format if stdout is a terminal, else in text format.
+func New() *Logger {
+	l := &Logger{
+		conf:         defaultConfig(),
+		tags:         newTags(),
+		edgeChannel:  make(chan *log.Log, defaultEdgeBuffer),
+		flushChannel: make(chan bool, 1),
+	}
+	l.stdout.Store(os.Stdout)
+	l.stdoutSink = &stdoutSink{l: l}
+	l.edgeSink = &edgeSink{l}
+	l.sinks = []Sink{l.stdoutSink, l.edgeSink}
+	if isTerminal(os.Stdout) {
+		l.Console()
+	}
+	return l
 }
 
-var l logging
+// std is the default logger used by package level functions.
+var std *Logger
+
+// Default returns the default logger used by package level functions.
+func Default() *Logger {
+	return std
+}
@@ -0,0 +1,95 @@
+package log
+
+// Report errors internal to log processing, such as edge transport errors.
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Stages of log processing, reported with internal errors.
+const (
+	StageEdgeClient = "edge client" // dialing edge server
+	StageToken      = "token"       // authenticating with API key
+	StageLogClient  = "log client"  // opening log stream
+	StageSend       = "send"        // sending logs
+	StageSink       = "sink"        // writing or flushing a sink
+	StageFormat     = "format"      // formatting a log via a template
+	StageRedirect   = "redirect"    // capturing stdout or stderr
+)
+
+// InternalError is an error in log processing, which can not be logged via
+// the logger itself.
+type InternalError struct {
+	Stage     string // stage of log processing
+	Retry     int    // retries at the stage so far
+	Backtrack bool   // retry limit reached, backtracking to previous stage
+	Err       error  // underlying error
+}
+
+// Error formats internal error as a single line.
+func (e *InternalError) Error() string {
+	msg := fmt.Sprintf("%s error: %v", e.Stage, e.Err)
+	if e.Retry > 0 {
+		msg += fmt.Sprintf(" (retry %d)", e.Retry)
+	}
+	if e.Backtrack {
+		msg += " (backtracking)"
+	}
+	return msg
+}
+
+// Unwrap returns underlying error.
+func (e *InternalError) Unwrap() error {
+	return e.Err
+}
+
+// diagnostics reports internal errors to a handler and/or writer, both
+// unset by default.
+type diagnostics struct {
+	mu      sync.Mutex
+	handler func(error)
+	output  io.Writer
+}
+
+// SetInternalErrorHandler sets handler for internal errors of default logger.
+func SetInternalErrorHandler(handler func(error)) {
+	std.SetInternalErrorHandler(handler)
+}
+
+// SetInternalErrorHandler sets handler for internal errors, nil to unset.
+// Errors passed to the handler are of type *InternalError.
+func (l *Logger) SetInternalErrorHandler(handler func(error)) {
+	l.diag.mu.Lock()
+	defer l.diag.mu.Unlock()
+	l.diag.handler = handler
+}
+
+// SetInternalOutput sets writer for internal errors of default logger.
+func SetInternalOutput(w io.Writer) {
+	std.SetInternalOutput(w)
+}
+
+// SetInternalOutput sets writer to print internal errors, one per line,
+// nil to turn off.
+//   log.SetInternalOutput(os.Stderr)
+func (l *Logger) SetInternalOutput(w io.Writer) {
+	l.diag.mu.Lock()
+	defer l.diag.mu.Unlock()
+	l.diag.output = w
+}
+
+// internalError reports an internal error.
+func (l *Logger) internalError(err *InternalError) {
+	l.diag.mu.Lock()
+	handler, output := l.diag.handler, l.diag.output
+	if output != nil {
+		io.WriteString(output, err.Error()+"\n")
+	}
+	l.diag.mu.Unlock()
+
+	if handler != nil {
+		handler(err)
+	}
+}
@@ -0,0 +1,169 @@
+package log
+
+// Encode logs as JSON.
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// DefaultJSONKeys returns default key names of JSON logs.
+func DefaultJSONKeys() EncoderKeys {
+	return EncoderKeys{
+		Level:     "type",
+		Time:      "timestamp",
+		File:      "file",
+		Line:      "line",
+		Function:  "function",
+		Verbosity: "verbosity",
+		Msg:       "msg",
+		Raw:       "raw",
+		Tags:      "tags",
+	}
+}
+
+// JSONEncoder encodes logs as single line JSON objects. Fields are encoded
+// in order of time, level, file, line, function, verbosity, msg, or raw for
+// raw logs, and tags. Time is RFC 3339 in UTC with nanoseconds. Tags are
+// nested under Tags key, in order of entry.
+type JSONEncoder struct {
+	Keys EncoderKeys
+}
+
+// defaultJSON encodes logs with default keys.
+var defaultJSON = &JSONEncoder{Keys: DefaultJSONKeys()}
+
+// SetJSONKeys sets key names of JSON logs of default logger.
+func SetJSONKeys(keys EncoderKeys) {
+	std.SetJSONKeys(keys)
+}
+
+// SetJSONKeys sets key names of logs printed as JSON, such as "level"
+// instead of "type", and "message" instead of "msg".
+//
+//	keys := log.DefaultJSONKeys()
+//	keys.Level, keys.Msg = "level", "message"
+//	log.SetJSONKeys(keys)
+func (l *Logger) SetJSONKeys(keys EncoderKeys) {
+	l.conf.json.Store(&JSONEncoder{Keys: keys})
+}
+
+// getJSON returns JSON encoder of logger.
+func (l *Logger) getJSON() *JSONEncoder {
+	if enc, _ := l.conf.json.Load().(*JSONEncoder); enc != nil {
+		return enc
+	}
+	return defaultJSON
+}
+
+// JsonFormat formats log as JSON, with default keys.
+func JsonFormat(lg *log.Log) string {
+	return string(defaultJSON.Format(lg, nil))
+}
+
+// Format appends log encoded as JSON to buf.
+func (enc *JSONEncoder) Format(lg *log.Log, buf []byte) []byte {
+	return enc.FormatEntry(NewEntry(lg), buf)
+}
+
+// FormatEntry appends log entry encoded as JSON to buf.
+func (enc *JSONEncoder) FormatEntry(e *Entry, buf []byte) []byte {
+	buf = append(buf, '{')
+	buf = appendFields(buf, e, &enc.Keys, jsonFields{})
+	return append(buf, '}')
+}
+
+// jsonFields encodes fields as JSON.
+type jsonFields struct{}
+
+func (jsonFields) appendKey(buf []byte, key string, first bool) []byte {
+	if !first {
+		buf = append(buf, ',')
+	}
+	buf = appendJSONString(buf, key)
+	return append(buf, ':')
+}
+
+func (jsonFields) appendString(buf []byte, s string) []byte {
+	return appendJSONString(buf, s)
+}
+
+func (jsonFields) appendTime(buf []byte, t time.Time) []byte {
+	buf = append(buf, '"')
+	buf = t.AppendFormat(buf, encoderTimeFormat)
+	return append(buf, '"')
+}
+
+func (enc jsonFields) appendTags(buf []byte, keys *EncoderKeys, tags EntryTags, first bool) []byte {
+	if keys.Tags != "" {
+		buf = enc.appendKey(buf, keys.Tags, first)
+		buf = append(buf, '{')
+		first = true
+	}
+	for _, tag := range tags {
+		if keys.Tags == "" {
+			buf = enc.appendKey(buf, keys.inlineKey(tag.Key), first)
+		} else {
+			buf = enc.appendKey(buf, tag.Key, first)
+		}
+		buf = appendJSONString(buf, tag.Value)
+		first = false
+	}
+	if keys.Tags != "" {
+		buf = append(buf, '}')
+	}
+	return buf
+}
+
+// appendJSONString appends s as a quoted JSON string, escaping quotes,
+// backslashes, control characters, invalid UTF-8, and line and paragraph
+// separators, as encoding/json does, except for HTML characters.
+func appendJSONString(buf []byte, s string) []byte {
+	buf = append(buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			buf = append(buf, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				buf = append(buf, '\\', c)
+			case '\n':
+				buf = append(buf, '\\', 'n')
+			case '\r':
+				buf = append(buf, '\\', 'r')
+			case '\t':
+				buf = append(buf, '\\', 't')
+			default:
+				buf = append(buf, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			buf = append(buf, s[start:i]...)
+			buf = append(buf, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf = append(buf, s[start:]...)
+	return append(buf, '"')
+}
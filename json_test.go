@@ -0,0 +1,147 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+var benchLog = &log.Log{
+	File:      "edge.go",
+	Line:      120,
+	Function:  "send",
+	Timestamp: 1538397000123,
+	Level:     log.Level_info,
+	Msg:       "sent logs",
+	Tags:      map[string]string{"count": "12", "user": "u1"},
+}
+
+func TestJSONEncoderTime(t *testing.T) {
+	tests := []struct {
+		e    *Entry
+		want string
+	}{
+		{NewEntry(&log.Log{Timestamp: 1538397000123}),
+			`"timestamp":"2018-10-01T12:30:00.123000000Z"`},
+		{&Entry{Log: &log.Log{}, Time: time.Unix(1538397000, 123456789)},
+			`"timestamp":"2018-10-01T12:30:00.123456789Z"`},
+		{&Entry{Log: &log.Log{}, Time: time.Unix(1538397000, 100)},
+			`"timestamp":"2018-10-01T12:30:00.000000100Z"`},
+		{&Entry{Log: &log.Log{}, Time: time.Unix(1538397000, 0).In(time.FixedZone("CET", 3600))},
+			`"timestamp":"2018-10-01T12:30:00.000000000Z"`},
+	}
+	for _, test := range tests {
+		out := defaultJSON.FormatEntry(test.e, nil)
+		if got := jsonField(t, out, "timestamp"); got != test.want {
+			t.Errorf("time of %v: got %s, want %s", test.e.Time, got, test.want)
+		}
+	}
+}
+
+func TestJSONEncoderEscape(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // decoded value, if other than in
+	}{
+		{"plain", "sent logs", ""},
+		{"quotes", `say "hi"`, ""},
+		{"backslashes", `C:\path\`, ""},
+		{"newlines", "line 1\nline 2\r\n", ""},
+		{"tab", "a\tb", ""},
+		{"control bytes", "\x00\x01\x1f\x7f", ""},
+		{"html", "<a href='x'>&</a>", ""},
+		{"unicode", "héllo, 世界", ""},
+		{"line separators", "a\u2028b\u2029c", ""},
+		{"invalid UTF-8", "a\xffb\xc3", "a\ufffdb\ufffd"},
+	}
+	for _, test := range tests {
+		out := defaultJSON.Format(&log.Log{
+			Level: log.Level_info,
+			Msg:   test.in,
+			Tags:  map[string]string{test.in: test.in},
+		}, nil)
+		if bytes.Contains(out, []byte("\n")) || bytes.Contains(out, []byte("\u2028")) {
+			t.Errorf("%s: unescaped line break in %q", test.name, out)
+		}
+
+		var decoded struct {
+			Msg  string            `json:"msg"`
+			Tags map[string]string `json:"tags"`
+		}
+		if err := json.Unmarshal(out, &decoded); err != nil {
+			t.Errorf("%s: invalid JSON %q: %v", test.name, out, err)
+			continue
+		}
+		want := test.want
+		if want == "" {
+			want = test.in
+		}
+		if decoded.Msg != want {
+			t.Errorf("%s: msg got %q, want %q", test.name, decoded.Msg, want)
+		}
+		if decoded.Tags[want] != want {
+			t.Errorf("%s: tags got %q, want %q", test.name, decoded.Tags, want)
+		}
+	}
+}
+
+func TestJSONEncoderInlineTags(t *testing.T) {
+	enc := &JSONEncoder{Keys: DefaultJSONKeys()}
+	enc.Keys.Tags = ""
+	out := enc.Format(&log.Log{
+		Level: log.Level_info,
+		Msg:   "hi",
+		Tags:  map[string]string{"msg": "tag", "user": "u1"},
+	}, nil)
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("invalid JSON %s: %v", out, err)
+	}
+	want := map[string]string{"msg": "hi", "tag.msg": "tag", "user": "u1"}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s: got %q, want %q in %s", k, fields[k], v, out)
+		}
+	}
+}
+
+// jsonField returns encoded key and value of key in out.
+func jsonField(t *testing.T, out []byte, key string) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(out, &fields); err != nil {
+		t.Fatalf("invalid JSON %s: %v", out, err)
+	}
+	return strconv.Quote(key) + ":" + string(fields[key])
+}
+
+func BenchmarkJSONEncoder(b *testing.B) {
+	b.ReportAllocs()
+	e := NewEntry(benchLog)
+	buf := make([]byte, 0, 512)
+	for i := 0; i < b.N; i++ {
+		defaultJSON.FormatEntry(e, buf[:0])
+	}
+}
+
+// BenchmarkEncodingJSON encodes the same log via encoding/json, to compare.
+func BenchmarkEncodingJSON(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		json.Marshal(map[string]interface{}{
+			"timestamp": benchLog.Timestamp,
+			"type":      benchLog.Level.String(),
+			"file":      benchLog.File,
+			"line":      benchLog.Line,
+			"function":  benchLog.Function,
+			"verbosity": benchLog.Verbosity,
+			"msg":       benchLog.Msg,
+			"tags":      benchLog.Tags,
+		})
+	}
+}
@@ -2,23 +2,75 @@ package log
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/blitzlog/proto/log"
 )
 
-func logLocal(lg *log.Log) {
-	if l.conf.logJson {
-		fmt.Fprintln(l.stdout, JsonFormat(lg))
-		return
+// stdoutSink prints logs to stdout of logger, via formatter of sink, or of
+// logger if nil.
+type stdoutSink struct {
+	l *Logger
+	f Formatter
+}
+
+// Write prints log to stdout if
+// - API key not set
+// - config set to log local
+// - error sending log to edge
+func (s *stdoutSink) Write(lg *log.Log) error {
+	return s.WriteEntry(s.l.entry(lg, logTime(lg), nil))
+}
+
+// WriteEntry prints log entry to stdout, as Write.
+func (s *stdoutSink) WriteEntry(e *Entry) error {
+	l := s.l
+	if l.getAPIKey() == "" || l.conf.logLocal || l.conf.apiError {
+		l.logLocal(e, s.f)
 	}
-	fmt.Fprintln(l.stdout, Format(lg))
+	return nil
+}
+
+// Flush syncs stdout.
+func (s *stdoutSink) Flush() error {
+	time.Sleep(time.Millisecond)
+	s.l.getStdout().Sync()
+	return nil
+}
+
+// Close is a no-op, stdout is left open.
+func (s *stdoutSink) Close() error {
+	return nil
+}
+
+// getStdout returns stdout to print logs to.
+func (l *Logger) getStdout() *os.File {
+	return l.stdout.Load().(*os.File)
+}
+
+// logLocal prints log to stdout via formatter, or formatter of logger if nil.
+func (l *Logger) logLocal(e *Entry, f Formatter) {
+	if f == nil {
+		f = l.getFormatter()
+	}
+	bp := bufPool.Get().(*[]byte)
+	buf := append(formatEntry(f, e, (*bp)[:0]), '\n')
+	l.getStdout().Write(buf)
+	*bp = buf
+	bufPool.Put(bp)
 }
 
 // format log as:
 // TMMDD HH:MM:SS.sss file:line <msg> <k1=v1 k2=v2>
 func Format(lg *log.Log) string {
+	return formatText(NewEntry(lg))
+}
+
+// formatText formats log entry as Format, with tags in order of entry.
+func formatText(e *Entry) string {
 
+	lg := e.Log
 	var buf []byte
 
 	switch lg.Level {
@@ -42,71 +94,17 @@ func Format(lg *log.Log) string {
 	if lg.Level == log.Level_none {
 		buf = append(buf, []byte(lg.GetRaw())...)
 	} else {
-		buf = append(buf, []byte(lg.GetFile())...)
-		buf = append(buf, []byte(":")...)
-		buf = append(buf, []byte(fmt.Sprintf("%d", lg.GetLine()))...)
-		buf = append(buf, []byte(" ")...)
-		buf = append(buf, []byte(lg.GetMsg())...)
-	}
-	tags := lg.GetTags()
-	for k, v := range tags {
-		buf = append(buf, fmt.Sprintf(" %s=%s", k, v)...)
-	}
-
-	return string(buf)
-}
-
-// JsonFormat log.
-func JsonFormat(lg *log.Log) string {
-
-	buf := []byte("{")
-
-	// TODO: use String()
-	switch lg.Level {
-	case log.Level_none:
-		buf = append(buf, []byte("\"type\":\"raw\"")...)
-	case log.Level_debug:
-		buf = append(buf, []byte("\"type\":\"debug\"")...)
-	case log.Level_info:
-		buf = append(buf, []byte("\"type\":\"info\"")...)
-	case log.Level_warn:
-		buf = append(buf, []byte("\"type\":\"warn\"")...)
-	case log.Level_error:
-		buf = append(buf, []byte("\"type\":\"error\"")...)
-	case log.Level_fatal:
-		buf = append(buf, []byte("\"type\":\"fatal\"")...)
-	}
-
-	ts := time.Unix(0, lg.GetTimestamp()*int64(time.Millisecond)).Format("2006-01-02 15:04:05.000")
-	tsStr := fmt.Sprintf(", \"timestamp\":\"%s\"", ts)
-	buf = append(buf, []byte(tsStr)...)
-	if lg.Level == log.Level_none {
-		buf = append(buf, []byte(", \"raw\":\"")...)
-		buf = append(buf, []byte(lg.GetRaw())...)
-		buf = append(buf, []byte("\"")...)
-	} else {
-		buf = append(buf, []byte(", \"file\":\"")...)
-		buf = append(buf, []byte(lg.GetFile())...)
-		buf = append(buf, []byte("\", \"line\":")...)
-		buf = append(buf, []byte(fmt.Sprintf("%d", lg.GetLine()))...)
-		buf = append(buf, []byte(", \"msg\":\"")...)
+		if lg.GetFile() != "" {
+			buf = append(buf, []byte(lg.GetFile())...)
+			buf = append(buf, []byte(":")...)
+			buf = append(buf, []byte(fmt.Sprintf("%d", lg.GetLine()))...)
+			buf = append(buf, []byte(" ")...)
+		}
 		buf = append(buf, []byte(lg.GetMsg())...)
-		buf = append(buf, []byte("\"")...)
 	}
-	tags := lg.GetTags()
-	if len(tags) != 0 {
-		buf = append(buf, []byte(", \"tags\":{")...)
-		first := true
-		for k, v := range tags {
-			if !first {
-				buf = append(buf, []byte(", ")...)
-			}
-			buf = append(buf, fmt.Sprintf("\"%s\":\"%s\"", k, v)...)
-			first = false
-		}
-		buf = append(buf, []byte("}")...)
+	for _, tag := range e.Tags {
+		buf = append(buf, fmt.Sprintf(" %s=%s", tag.Key, tag.Value)...)
 	}
-	buf = append(buf, []byte("}")...)
 
 	return string(buf)
 }
@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"reflect"
 	"runtime"
 	"strings"
 	"time"
@@ -13,249 +14,334 @@ const ErrorKey = "error"
 
 // With adds tags to log.
 func (v *Verbosity) With(tags Tags) *VTags {
-	return &VTags{v, tags}
+	return &VTags{std, v, tags.fields()}
+}
+
+// WithFields adds typed tags to log.
+func (v *Verbosity) WithFields(fields ...Field) *VTags {
+	return &VTags{std, v, fields}
 }
 
 func (v *Verbosity) Tag(key string, val interface{}) *VTags {
-	tags := Tags{key: val}
-	return &VTags{v, tags}
+	return &VTags{std, v, []Field{Any(key, val)}}
 }
 
 func (v *Verbosity) D(format string, args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_debug, nil, format, args)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_debug, nil, format, args)
 	}
 }
 
 func (v *Verbosity) I(format string, args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_info, nil, format, args)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_info, nil, format, args)
 	}
 }
 
 func (v *Verbosity) W(format string, args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_warn, nil, format, args)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_warn, nil, format, args)
 	}
 }
 
 func (v *Verbosity) E(format string, args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_error, nil, format, args)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_error, nil, format, args)
 	}
 }
 
 func (v *Verbosity) F(format string, args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_fatal, nil, format, args)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_fatal, nil, format, args)
 	}
 }
 
 func (v *Verbosity) Debug(args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_debug, nil, fmt.Sprint(args...), nil)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_debug, nil, fmt.Sprint(args...), nil)
 	}
 }
 
 func (v *Verbosity) Info(args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_info, nil, fmt.Sprint(args...), nil)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_info, nil, fmt.Sprint(args...), nil)
 	}
 }
 
 func (v *Verbosity) Warn(args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_warn, nil, fmt.Sprint(args...), nil)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_warn, nil, fmt.Sprint(args...), nil)
 	}
 }
 
 func (v *Verbosity) Error(args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_error, nil, fmt.Sprint(args...), nil)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_error, nil, fmt.Sprint(args...), nil)
 	}
 }
 
 func (v *Verbosity) Fatal(args ...interface{}) {
-	if v.verbose() {
-		pushLog(v, log.Level_fatal, nil, fmt.Sprint(args...), nil)
+	if v.verbose(std) {
+		std.pushLog(0, v, log.Level_fatal, nil, fmt.Sprint(args...), nil)
 	}
 }
 
 type Tags map[string]interface{}
 
-func (tags Tags) stringTags() map[string]string {
-	strTags := make(map[string]string)
-	for k, v := range tags {
-		strTags[k] = String(v)
-	}
-	return strTags
-}
-
 type VTags struct {
-	v    *Verbosity
-	tags Tags
+	l      *Logger
+	v      *Verbosity
+	fields []Field
 }
 
 // With adds tags to log.
 func With(tags Tags) *VTags {
-	return &VTags{defaultVerbosity, tags}
+	return std.With(tags)
+}
+
+// With adds tags to log sent via this logger.
+func (l *Logger) With(tags Tags) *VTags {
+	return &VTags{l, defaultVerbosity, tags.fields()}
+}
+
+// WithFields adds typed tags to log.
+//   log.WithFields(log.Str("user", id), log.Dur("took", d)).I("done")
+func WithFields(fields ...Field) *VTags {
+	return std.WithFields(fields...)
+}
+
+// WithFields adds typed tags to log sent via this logger.
+func (l *Logger) WithFields(fields ...Field) *VTags {
+	return &VTags{l, defaultVerbosity, fields}
 }
 
 func Tag(k string, v interface{}) *VTags {
-	return &VTags{defaultVerbosity, Tags{k: v}}
+	return std.Tag(k, v)
+}
+
+func (l *Logger) Tag(k string, v interface{}) *VTags {
+	return &VTags{l, defaultVerbosity, []Field{Any(k, v)}}
 }
 
 // With add tags to vtag.
 func (vtags *VTags) With(tags Tags) *VTags {
-	for k, v := range tags {
-		vtags.tags[k] = v
-	}
+	vtags.fields = append(vtags.fields, tags.fields()...)
+	return vtags
+}
+
+// WithFields adds typed tags to vtag.
+func (vtags *VTags) WithFields(fields ...Field) *VTags {
+	vtags.fields = append(vtags.fields, fields...)
 	return vtags
 }
 
 func (vtags *VTags) Tag(k string, v interface{}) *VTags {
-	vtags.tags[k] = v
+	vtags.fields = append(vtags.fields, Any(k, v))
 	return vtags
 }
 
 func WithError(err error) *VTags {
-	tags := map[string]interface{}{ErrorKey: err}
-	return &VTags{defaultVerbosity, tags}
+	return std.WithError(err)
+}
+
+func (l *Logger) WithError(err error) *VTags {
+	return &VTags{l, defaultVerbosity, []Field{Err(err)}}
 }
 
 func (vtags *VTags) WithError(err error) *VTags {
-	vtags.tags[ErrorKey] = err
+	vtags.fields = append(vtags.fields, Err(err))
 	return vtags
 }
 
 func (v *Verbosity) WithError(err error) *VTags {
-	tags := map[string]interface{}{ErrorKey: err}
-	return &VTags{v, tags}
+	return &VTags{std, v, []Field{Err(err)}}
 }
 
 func (vtags *VTags) D(format string, args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_debug, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_debug, vtags.fields,
 			format, args)
 	}
 }
 
 func (vtags *VTags) I(format string, args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_info, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_info, vtags.fields,
 			format, args)
 	}
 }
 
 func (vtags *VTags) W(format string, args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_warn, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_warn, vtags.fields,
 			format, args)
 	}
 }
 
 func (vtags *VTags) E(format string, args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_error, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_error, vtags.fields,
 			format, args)
 	}
 }
 
 func (vtags *VTags) F(format string, args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_fatal, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_fatal, vtags.fields,
 			format, args)
 	}
 }
 
 func (vtags *VTags) Debug(args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_debug, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_debug, vtags.fields,
 			fmt.Sprint(args...), nil)
 	}
 }
 
 func (vtags *VTags) Info(args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_info, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_info, vtags.fields,
 			fmt.Sprint(args...), nil)
 	}
 }
 
 func (vtags *VTags) Warn(args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_warn, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_warn, vtags.fields,
 			fmt.Sprint(args...), nil)
 	}
 }
 
 func (vtags *VTags) Error(args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_error, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_error, vtags.fields,
 			fmt.Sprint(args...), nil)
 	}
 }
 
 func (vtags *VTags) Fatal(args ...interface{}) {
-	if vtags.v.verbose() {
-		pushLog(defaultVerbosity, log.Level_fatal, vtags.tags,
+	if vtags.v.verbose(vtags.l) {
+		vtags.l.pushLog(0, vtags.v, log.Level_fatal, vtags.fields,
 			fmt.Sprint(args...), nil)
 	}
 }
 
 func D(format string, args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_debug, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_debug, nil,
+		format, args)
+}
+
+func (l *Logger) D(format string, args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_debug, nil,
 		format, args)
 }
 
 func I(format string, args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_info, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_info, nil,
+		format, args)
+}
+
+func (l *Logger) I(format string, args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_info, nil,
 		format, args)
 }
 
 func W(format string, args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_warn, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_warn, nil,
+		format, args)
+}
+
+func (l *Logger) W(format string, args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_warn, nil,
 		format, args)
 }
 
 func E(format string, args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_error, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_error, nil,
+		format, args)
+}
+
+func (l *Logger) E(format string, args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_error, nil,
 		format, args)
 }
 
 func F(format string, args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_fatal, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_fatal, nil,
+		format, args)
+}
+
+func (l *Logger) F(format string, args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_fatal, nil,
 		format, args)
 }
 
 func Debug(args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_debug, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_debug, nil,
+		fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Debug(args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_debug, nil,
 		fmt.Sprint(args...), nil)
 }
 
 func Info(args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_info, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_info, nil,
+		fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Info(args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_info, nil,
 		fmt.Sprint(args...), nil)
 }
 
 func Warn(args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_warn, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_warn, nil,
+		fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Warn(args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_warn, nil,
 		fmt.Sprint(args...), nil)
 }
 
 func Error(args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_error, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_error, nil,
+		fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Error(args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_error, nil,
 		fmt.Sprint(args...), nil)
 }
 
 func Fatal(args ...interface{}) {
-	pushLog(defaultVerbosity, log.Level_fatal, nil,
+	std.pushLog(0, defaultVerbosity, log.Level_fatal, nil,
+		fmt.Sprint(args...), nil)
+}
+
+func (l *Logger) Fatal(args ...interface{}) {
+	l.pushLog(0, defaultVerbosity, log.Level_fatal, nil,
 		fmt.Sprint(args...), nil)
 }
 
-// pushLog creates a Log object and pushes it over the encodeChannel.
-func pushLog(verbosity *Verbosity, level log.Level, tags Tags,
-	format string, args []interface{}) {
+// logAt logs message at given level with extra fields, for logs whose level
+// is known at run time only. Log is attributed to the call site depth frames
+// above caller of logAt, both for vmodule rules and file line.
+func (vtags *VTags) logAt(depth int, level log.Level, fields []Field, msg string) {
+	if vtags.v.verboseDepth(vtags.l, depth) {
+		vtags.l.pushLog(depth, vtags.v, level,
+			append(vtags.fields[:len(vtags.fields):len(vtags.fields)], fields...),
+			"%s", []interface{}{msg})
+	}
+}
+
+// pushLog creates a Log object and pushes it over the encodeChannel. Log is
+// attributed to the call site depth frames above caller of log method.
+func (l *Logger) pushLog(depth int, verbosity *Verbosity, level log.Level,
+	fields []Field, format string, args []interface{}) {
 
 	// check if this log type is to be logged
 	if level < l.conf.logLevel {
@@ -263,24 +349,53 @@ func pushLog(verbosity *Verbosity, level log.Level, tags Tags,
 	}
 
 	// get location info for the log
-	file, function, line := fileLine(3)
+	file, function, line := fileLine(3 + depth)
+
+	// check if sampled, before formatting message
+	suppressed, ok := l.sample(file, line, level)
+	if !ok {
+		return
+	}
 
-	mux(&log.Log{
+	now := time.Now()
+	msg := fmt.Sprintf(format, args...)
+	l.publishSampled(&log.Log{
 		File:      file,
 		Line:      int32(line),
 		Function:  function,
-		Timestamp: time.Now().UTC().UnixNano() / 1e6,
+		Timestamp: now.UTC().UnixNano() / 1e6,
 		Level:     level,
 		Verbosity: int32(*verbosity),
-		Msg:       fmt.Sprintf(format, args...),
-		Tags:      tags.stringTags(),
-	})
+		Msg:       msg,
+	}, now, fields, suppressed)
 	if level == log.Level_fatal {
-		Flush()
-		panic(fmt.Sprintf(format, args...))
+		l.flush()
+		panic(fatalPanic(msg))
+	}
+}
+
+// publish log at time t with given fields as tags, if sampled.
+func (l *Logger) publish(lg *log.Log, t time.Time, fields []Field) {
+
+	// check if sampled, and report logs suppressed at call site
+	suppressed, ok := l.sample(lg.File, int(lg.Line), lg.Level)
+	if ok {
+		l.publishSampled(lg, t, fields, suppressed)
 	}
 }
 
+// publishSampled publishes log at time t admitted by sampling, with given
+// fields as tags, reporting logs suppressed at call site since the last one.
+func (l *Logger) publishSampled(lg *log.Log, t time.Time, fields []Field, suppressed int64) {
+	if suppressed > 0 {
+		fields = append(fields[:len(fields):len(fields)],
+			Int64(SuppressedKey, suppressed))
+	}
+
+	lg.Tags = stringTags(fields)
+	l.mux(lg, t, fieldKeys(fields))
+}
+
 // fileLine returns the file, function and line for calling function.
 func fileLine(depth int) (string, string, int) {
 
@@ -289,22 +404,35 @@ func fileLine(depth int) (string, string, int) {
 		return "???", "???", 1
 	}
 
-	// prune file name
-	slash := strings.LastIndex(file, "/")
-	if slash >= 0 {
-		file = file[slash+1:]
-	}
-
-	// get function name
-	fn := runtime.FuncForPC(pc).Name()
-	slash = strings.LastIndex(fn, "/")
-	if slash >= 0 {
-		fn = fn[slash+1:]
-	}
-	slash = strings.LastIndex(fn, ".")
-	if slash >= 0 {
-		fn = fn[slash+1:]
+	// prune file and function name
+	return shortFile(file), shortFunction(runtime.FuncForPC(pc).Name()), line
+}
+
+// callerDepth returns depth, above caller of callerDepth, of first frame of
+// a function outside packages with given prefixes, or 0 if none is.
+func callerDepth(prefixes []string) int {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	for depth := 0; ; depth++ {
+		frame, more := frames.Next()
+		inside := false
+		for _, p := range prefixes {
+			if strings.HasPrefix(frame.Function, p) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return depth
+		}
+		if !more {
+			return 0
+		}
 	}
+}
 
-	return file, fn, line
+// funcPackage returns package path of function, with trailing dot.
+func funcPackage(f interface{}) string {
+	name := runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+	return name[:strings.LastIndex(name, ".")+1]
 }
@@ -0,0 +1,155 @@
+package log
+
+// Encode logs as logfmt.
+
+import (
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// DefaultLogfmtKeys returns default key names of logfmt logs.
+func DefaultLogfmtKeys() EncoderKeys {
+	return EncoderKeys{
+		Level:     "level",
+		Time:      "ts",
+		File:      "file",
+		Function:  "func",
+		Verbosity: "v",
+		Msg:       "msg",
+		Raw:       "raw",
+	}
+}
+
+// LogfmtEncoder encodes logs as logfmt, space separated key=value pairs,
+// such as:
+//
+//	ts=2018-10-02T15:04:05.123456789Z level=info file=edge.go:120 func=send v=0 msg="sent logs" count=12
+//
+// Fields are encoded in same order as by JSONEncoder, with tags inlined,
+// or prefixed with Tags key and a dot. Values with spaces, quotes, equal
+// signs or control characters are quoted and escaped.
+type LogfmtEncoder struct {
+	Keys EncoderKeys
+}
+
+// defaultLogfmt encodes logs with default keys.
+var defaultLogfmt = &LogfmtEncoder{Keys: DefaultLogfmtKeys()}
+
+// Logfmt prints logs of default logger as logfmt.
+func Logfmt() {
+	std.Logfmt()
+}
+
+// Logfmt prints logs as logfmt, instead of human readable format.
+func (l *Logger) Logfmt() {
+	l.setLocalFormat(FormatLogfmt)
+}
+
+// LogfmtFormat formats log as logfmt, with default keys.
+func LogfmtFormat(lg *log.Log) string {
+	return string(defaultLogfmt.Format(lg, nil))
+}
+
+// Format appends log encoded as logfmt to buf.
+func (enc *LogfmtEncoder) Format(lg *log.Log, buf []byte) []byte {
+	return enc.FormatEntry(NewEntry(lg), buf)
+}
+
+// FormatEntry appends log entry encoded as logfmt to buf.
+func (enc *LogfmtEncoder) FormatEntry(e *Entry, buf []byte) []byte {
+	return appendFields(buf, e, &enc.Keys, logfmtFields{})
+}
+
+// logfmtFields encodes fields as logfmt.
+type logfmtFields struct{}
+
+func (logfmtFields) appendKey(buf []byte, key string, first bool) []byte {
+	if !first {
+		buf = append(buf, ' ')
+	}
+	buf = appendLogfmtKey(buf, key)
+	return append(buf, '=')
+}
+
+func (logfmtFields) appendString(buf []byte, s string) []byte {
+	return appendLogfmtValue(buf, s)
+}
+
+func (logfmtFields) appendTime(buf []byte, t time.Time) []byte {
+	return t.AppendFormat(buf, encoderTimeFormat)
+}
+
+func (enc logfmtFields) appendTags(buf []byte, keys *EncoderKeys, tags EntryTags, first bool) []byte {
+	for _, tag := range tags {
+		if !first {
+			buf = append(buf, ' ')
+		}
+		if keys.Tags != "" {
+			buf = appendLogfmtKey(buf, keys.Tags)
+			buf = append(buf, '.')
+			buf = appendLogfmtKey(buf, tag.Key)
+		} else {
+			buf = appendLogfmtKey(buf, keys.inlineKey(tag.Key))
+		}
+		buf = append(buf, '=')
+		buf = appendLogfmtValue(buf, tag.Value)
+		first = false
+	}
+	return buf
+}
+
+// appendLogfmtKey appends key, replacing characters not allowed in keys,
+// i.e. spaces, quotes, equal signs, and control or invalid characters, with
+// '_'.
+func appendLogfmtKey(buf []byte, key string) []byte {
+	if key == "" {
+		return append(buf, '_')
+	}
+	for i := 0; i < len(key); {
+		r, size := utf8.DecodeRuneInString(key[i:])
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError ||
+			!unicode.IsPrint(r) {
+			buf = append(buf, '_')
+		} else {
+			buf = append(buf, key[i:i+size]...)
+		}
+		i += size
+	}
+	return buf
+}
+
+// appendLogfmtValue appends value, quoted and escaped if needed.
+func appendLogfmtValue(buf []byte, s string) []byte {
+	if !needsQuote(s) {
+		return append(buf, s...)
+	}
+	return appendJSONString(buf, s)
+}
+
+// needsQuote checks if logfmt value needs quoting, i.e. if it is empty, or
+// has spaces, quotes, equal signs, backslashes, or control or invalid
+// characters.
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c <= ' ' || c == '=' || c == '"' || c == '\\' || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
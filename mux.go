@@ -1,23 +1,25 @@
 package log
 
 import (
+	"time"
+
 	"github.com/blitzlog/proto/log"
 )
 
-// mux log to local and/or edge.
-func mux(lg *log.Log) {
-
-	// log local if
-	// - API key not set
-	// - config set to log local
-	// - error sending log to edge
-	if l.conf.apiKey == "" || l.conf.logLocal || l.conf.apiError {
-		logLocal(lg)
-	}
+// mux log of time t to all sinks, with keys of its tags in call order.
+func (l *Logger) mux(lg *log.Log, t time.Time, keys []string) {
+	l.muxExcept(lg, t, keys, nil)
+}
 
-	// log edge if api key is set and no errors sending to edge.
-	if l.conf.apiKey != "" && !l.conf.apiError {
-		l.wg.Add(1)
-		l.edgeChannel <- lg
+// muxExcept muxes log to all sinks, except those skipped, if skip is set.
+func (l *Logger) muxExcept(lg *log.Log, t time.Time, keys []string, skip func(Sink) bool) {
+	e := l.entry(lg, t, keys)
+	for _, sink := range l.getSinks() {
+		if skip != nil && skip(sink) {
+			continue
+		}
+		if err := writeEntry(sink, e); err != nil {
+			l.internalError(&InternalError{Stage: StageSink, Err: err})
+		}
 	}
 }
@@ -0,0 +1,165 @@
+package log
+
+// Order tags of formatted logs deterministically.
+
+import (
+	"sort"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// TagOrder is the order of tags in formatted logs.
+type TagOrder int
+
+const (
+	// TagOrderCall orders tags as added by caller, default. Tags of a
+	// Tags map are sorted by key, being unordered.
+	TagOrderCall TagOrder = iota
+	// TagOrderSorted orders tags by key.
+	TagOrderSorted
+)
+
+// Entry is a log published to sinks implementing EntrySink, and formatted
+// by formatters implementing EntryFormatter. Log is the log as sent to edge,
+// with tags of the log line. Tags are the tags to format, in order: tags of
+// the line, in order set by SetTagOrder, then global tags not set by the
+// line, sorted by key. Raw logs have no global tags, being printed as
+// captured. Time is time of log, in nanoseconds, whereas Log has it in
+// milliseconds.
+type Entry struct {
+	Log  *log.Log
+	Time time.Time
+	Tags EntryTags
+}
+
+// EntryTag is a tag of a log entry.
+type EntryTag struct {
+	Key   string
+	Value string
+}
+
+// EntryTags are tags of a log entry, in order. They may be looked up, such
+// as with {{.Tags.Get "user"}} in a template.
+type EntryTags []EntryTag
+
+// Get returns value of tag, empty if not set.
+func (tags EntryTags) Get(key string) string {
+	for _, tag := range tags {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+// String formats tags as space separated key=value pairs, as logfmt.
+func (tags EntryTags) String() string {
+	var buf []byte
+	for i, tag := range tags {
+		if i > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = appendLogfmtKey(buf, tag.Key)
+		buf = append(buf, '=')
+		buf = appendLogfmtValue(buf, tag.Value)
+	}
+	return string(buf)
+}
+
+// NewEntry returns entry of log, with its tags sorted by key, as for logs
+// written to a sink, or formatted, directly. Time is that of log, in
+// milliseconds.
+func NewEntry(lg *log.Log) *Entry {
+	return &Entry{Log: lg, Time: logTime(lg), Tags: lineTags(lg.GetTags(), nil)}
+}
+
+// time returns time of entry in UTC, or of its log if not set.
+func (e *Entry) time() time.Time {
+	if e.Time.IsZero() {
+		return logTime(e.Log)
+	}
+	return e.Time.UTC()
+}
+
+// SetTagOrder sets tag order of default logger.
+func SetTagOrder(order TagOrder) {
+	std.SetTagOrder(order)
+}
+
+// SetTagOrder sets order of tags of log lines, in all formats. Global tags
+// follow, sorted by key.
+func (l *Logger) SetTagOrder(order TagOrder) {
+	l.conf.tagOrder = order
+}
+
+// entry returns entry of log of time t, with tags of the line in order of
+// keys, as set by SetTagOrder, followed by global tags.
+func (l *Logger) entry(lg *log.Log, t time.Time, keys []string) *Entry {
+	if l.conf.tagOrder != TagOrderCall {
+		keys = nil
+	}
+	tags := lineTags(lg.GetTags(), keys)
+	if lg.GetLevel() != log.Level_none {
+		for _, tag := range l.globalTags() {
+			if _, ok := lg.GetTags()[tag.Key]; !ok {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return &Entry{Log: lg, Time: t, Tags: tags}
+}
+
+// fieldKeys returns keys of fields, in order of first occurrence.
+func fieldKeys(fields []Field) []string {
+	keys := make([]string, 0, len(fields))
+	for i, f := range fields {
+		dup := false
+		for _, prev := range fields[:i] {
+			if prev.key == f.key {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+// lineTags returns tags in order of keys, followed by other tags sorted by
+// key.
+func lineTags(tags map[string]string, keys []string) EntryTags {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	ordered := make(EntryTags, 0, len(tags))
+	for _, k := range keys {
+		if v, ok := tags[k]; ok {
+			ordered = append(ordered, EntryTag{k, v})
+		}
+	}
+	if len(ordered) == len(tags) {
+		return ordered
+	}
+
+	// sort tags not in keys
+	n := len(ordered)
+	for k, v := range tags {
+		found := false
+		for _, tag := range ordered[:n] {
+			if tag.Key == k {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ordered = append(ordered, EntryTag{k, v})
+		}
+	}
+	rest := ordered[n:]
+	sort.Slice(rest, func(i, j int) bool { return rest[i].Key < rest[j].Key })
+	return ordered
+}
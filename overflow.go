@@ -0,0 +1,99 @@
+package log
+
+// Handle logs pushed while edge channel is full.
+
+import (
+	"sync/atomic"
+
+	"github.com/blitzlog/errors"
+	"github.com/blitzlog/proto/log"
+)
+
+// Overflow is the policy for logs pushed while edge channel is full.
+type Overflow int
+
+const (
+	// OverflowDropNewest drops the log being pushed, default.
+	OverflowDropNewest Overflow = iota
+	// OverflowDropOldest drops the oldest log in channel, to make room.
+	OverflowDropOldest
+	// OverflowBlock blocks until sender daemon makes room.
+	OverflowBlock
+)
+
+// defaultEdgeBuffer is the default size of edge channel.
+const defaultEdgeBuffer = 1000
+
+// SetOverflow sets overflow policy of default logger.
+func SetOverflow(policy Overflow) {
+	std.SetOverflow(policy)
+}
+
+// SetOverflow sets policy for logs pushed while edge channel is full.
+func (l *Logger) SetOverflow(policy Overflow) {
+	l.conf.overflow = policy
+}
+
+// SetEdgeBuffer sets size of edge channel of default logger.
+func SetEdgeBuffer(size int) error {
+	return std.SetEdgeBuffer(size)
+}
+
+// SetEdgeBuffer sets size of channel buffering logs for sender daemon. It
+// must be set before API key.
+func (l *Logger) SetEdgeBuffer(size int) error {
+	if l.getAPIKey() != "" {
+		return errors.New("edge buffer must be set before API key")
+	}
+	if size < 1 {
+		return errors.New("invalid edge buffer size: %d", size)
+	}
+	l.edgeChannel = make(chan *log.Log, size)
+	return nil
+}
+
+// Dropped returns count of logs of default logger dropped on overflow.
+func Dropped() int64 {
+	return std.Dropped()
+}
+
+// Dropped returns count of logs dropped on overflow of edge channel.
+func (l *Logger) Dropped() int64 {
+	return atomic.LoadInt64(&l.dropped)
+}
+
+// pushEdge pushes log to edge channel, as per overflow policy.
+func (l *Logger) pushEdge(lg *log.Log) {
+	l.pending.add(1)
+
+	if l.conf.overflow == OverflowBlock {
+		l.edgeChannel <- lg
+		return
+	}
+
+	for {
+		select {
+		case l.edgeChannel <- lg:
+			return
+		default:
+		}
+
+		if l.conf.overflow == OverflowDropNewest {
+			l.drop()
+			return
+		}
+
+		// make room by dropping oldest log, and retry
+		select {
+		case <-l.edgeChannel:
+			l.drop()
+		default:
+		}
+	}
+}
+
+// drop counts a dropped log.
+func (l *Logger) drop() {
+	atomic.AddInt64(&l.dropped, 1)
+	l.pending.done(1)
+}
@@ -0,0 +1,229 @@
+package log
+
+// Capture panics in any goroutine as fatal logs.
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// Tags of panic logs.
+const (
+	PanicKey     = "panic"     // value passed to panic
+	GoroutineKey = "goroutine" // id of panicking goroutine
+	StackKey     = "stack"     // prefix of stack frame tags, stack.0 first
+)
+
+// maxStackFrames is the max stack frames reported with a panic.
+const maxStackFrames = 32
+
+// fatalPanic is the panic of a fatal log, already published and flushed.
+type fatalPanic string
+
+// Error returns message of fatal log, so an unrecovered panic prints it.
+func (p fatalPanic) Error() string {
+	return string(p)
+}
+
+// PanicMode is what to do once a recovered panic is logged and flushed.
+type PanicMode int
+
+const (
+	// PanicRepanic panics again with the recovered value, default.
+	PanicRepanic PanicMode = iota
+	// PanicExit exits with status 2, as an unrecovered panic does.
+	PanicExit
+)
+
+// SetPanicMode sets panic mode of default logger.
+func SetPanicMode(mode PanicMode) {
+	std.SetPanicMode(mode)
+}
+
+// SetPanicMode sets what to do once a recovered panic is logged.
+func (l *Logger) SetPanicMode(mode PanicMode) {
+	l.conf.panicMode = mode
+}
+
+// Recover recovers panic via default logger. It must be deferred directly.
+func Recover() {
+	// recover must be called directly by the deferred function
+	if r := recover(); r != nil {
+		std.HandlePanic(r)
+	}
+}
+
+// Recover recovers panic, publishes it as fatal log with stack frames,
+// flushes logs, and then panics again or exits as per panic mode. It must
+// be deferred directly, in the goroutine to watch.
+//
+//	defer log.Recover()
+func (l *Logger) Recover() {
+	// recover must be called directly by the deferred function
+	if r := recover(); r != nil {
+		l.HandlePanic(r)
+	}
+}
+
+// Go runs function in a new goroutine, recovering panics via default
+// logger.
+func Go(f func()) {
+	std.Go(f)
+}
+
+// Go runs function in a new goroutine, recovering panics as Recover does.
+func (l *Logger) Go(f func()) {
+	go func() {
+		defer l.Recover()
+		f()
+	}()
+}
+
+// HandlePanic handles panic recovered by default logger.
+func HandlePanic(r interface{}) {
+	std.HandlePanic(r)
+}
+
+// HandlePanic handles value recovered by caller's own deferred function, as
+// Recover does. It is called while panicking, so that stack frames are of
+// the panicking function. Panics of fatal logs are not published again.
+func (l *Logger) HandlePanic(r interface{}) {
+	if _, ok := r.(fatalPanic); ok {
+		l.endPanic(r)
+	}
+
+	frames := panicFrames()
+
+	// report panicking frame as log location
+	var file, function string
+	var line int
+	if len(frames) > 0 {
+		file = shortFile(frames[0].File)
+		function = shortFunction(frames[0].Function)
+		line = frames[0].Line
+	}
+
+	tags := map[string]string{
+		PanicKey:     fmt.Sprint(r),
+		GoroutineKey: goroutineID(),
+	}
+	keys := []string{PanicKey, GoroutineKey}
+	for i, frame := range frames {
+		key := StackKey + "." + strconv.Itoa(i)
+		tags[key] = fmt.Sprintf("%s %s:%d",
+			trimPackagePath(frame.Function), shortFile(frame.File), frame.Line)
+		keys = append(keys, key)
+	}
+
+	now := time.Now()
+	l.mux(&log.Log{
+		File:      file,
+		Line:      int32(line),
+		Function:  function,
+		Timestamp: now.UTC().UnixNano() / 1e6,
+		Level:     log.Level_fatal,
+		Msg:       fmt.Sprintf("panic: %v", r),
+		Tags:      tags,
+	}, now, keys)
+	l.flush()
+	l.endPanic(r)
+}
+
+// endPanic panics again with recovered value, or exits, as per panic mode.
+func (l *Logger) endPanic(r interface{}) {
+	if l.conf.panicMode == PanicExit {
+		os.Exit(2)
+	}
+	panic(r)
+}
+
+// panicFrames returns frames of panicking function and its callers. While
+// panicking, these are frames below runtime.gopanic, skipping runtime
+// frames raising the panic, such as for a nil dereference. Else they are
+// frames from caller of HandlePanic. Goroutine exit frames are skipped.
+func panicFrames() []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(1, pcs)
+	iter := runtime.CallersFrames(pcs[:n])
+
+	var all []runtime.Frame
+	panicAt := -1
+	for {
+		frame, more := iter.Next()
+		all = append(all, frame)
+		if panicAt < 0 && frame.Function == "runtime.gopanic" {
+			panicAt = len(all)
+		}
+		if !more {
+			break
+		}
+	}
+
+	// skip panicFrames, HandlePanic and its wrappers, if not panicking
+	start := panicAt
+	if start < 0 {
+		start = 1
+		for start < len(all) &&
+			strings.HasPrefix(shortFunction(all[start].Function), "HandlePanic") {
+			start++
+		}
+	}
+	for start < len(all) && strings.HasPrefix(all[start].Function, "runtime.") {
+		start++
+	}
+
+	end := len(all)
+	for end > start && strings.HasPrefix(all[end-1].Function, "runtime.") {
+		end--
+	}
+
+	frames := all[start:end]
+	if len(frames) > maxStackFrames {
+		frames = frames[:maxStackFrames]
+	}
+	return frames
+}
+
+// goroutineID returns id of current goroutine, from its stack header.
+func goroutineID() string {
+	var buf [64]byte
+	stack := buf[:runtime.Stack(buf[:], false)]
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		return string(stack[:i])
+	}
+	return ""
+}
+
+// shortFile returns file name without directories.
+func shortFile(file string) string {
+	if slash := strings.LastIndex(file, "/"); slash >= 0 {
+		return file[slash+1:]
+	}
+	return file
+}
+
+// trimPackagePath returns function name with package name but without
+// package path.
+func trimPackagePath(fn string) string {
+	if slash := strings.LastIndex(fn, "/"); slash >= 0 {
+		return fn[slash+1:]
+	}
+	return fn
+}
+
+// shortFunction returns function name without package and receiver.
+func shortFunction(fn string) string {
+	fn = trimPackagePath(fn)
+	if dot := strings.LastIndex(fn, "."); dot >= 0 {
+		return fn[dot+1:]
+	}
+	return fn
+}
@@ -1,33 +1,279 @@
 package log
 
+// Capture stdout and stderr as raw logs.
+
 import (
 	"bufio"
+	"context"
+	"io"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/blitzlog/errors"
 	"github.com/blitzlog/proto/log"
 )
 
-// redirect stdout to log channel.
-func redirect() {
+// dumpIdle is the time after last line of a goroutine dump, after which the
+// dump is published.
+const dumpIdle = 100 * time.Millisecond
+
+// capture captures output written to stdout or stderr.
+type capture struct {
+	name    string      // stdout or stderr
+	std     **os.File   // os.Stdout or os.Stderr
+	orig    *os.File    // original output, captured output is teed to
+	r, w    *os.File    // pipe output is captured via
+	fd      uintptr     // descriptor of captured output
+	pipe    os.FileInfo // write end of pipe, to find sinks writing to it
+	restore func()      // restores original output
+	done    chan struct{}
+}
+
+// CaptureStdout captures stdout via default logger.
+func CaptureStdout() error {
+	return std.CaptureStdout()
+}
+
+// CaptureStdout publishes output written to stdout, such as by fmt.Println,
+// as raw logs. Output is still printed to original stdout. Logs printed to
+// stdout by this logger are not captured. Captured output is not published
+// to Stdout sink, nor to sinks writing to captured stdout or stderr, such as
+// a writer sink on os.Stderr, which would capture it again. Capture is
+// process wide, so it is to be set on one logger only. It stops on Close.
+func (l *Logger) CaptureStdout() error {
+	return l.startCapture("stdout", &os.Stdout)
+}
+
+// CaptureStderr captures stderr via default logger.
+func CaptureStderr() error {
+	return std.CaptureStderr()
+}
+
+// CaptureStderr publishes output written to stderr as raw logs, as
+// CaptureStdout does. Goroutine dumps, such as of a panic, are published as
+// a single log. Output of a panic that crashes the program is captured on
+// a best effort basis, as the program may exit before it is published; see
+// Recover for reliably publishing panics.
+func (l *Logger) CaptureStderr() error {
+	return l.startCapture("stderr", &os.Stderr)
+}
+
+// startCapture redirects output to a pipe, and starts capturing it.
+func (l *Logger) startCapture(name string, std **os.File) error {
+	l.captureMu.Lock()
+	defer l.captureMu.Unlock()
+
+	for _, c := range l.captures {
+		if c.name == name {
+			return nil
+		}
+	}
 
 	r, w, err := os.Pipe()
 	if err != nil {
-		panic(err)
-	}
-	os.Stdout = w
-	reader := bufio.NewReader(r)
-	go func() {
-		for {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				l.errFile.WriteString(err.Error())
+		return errors.Wrap(err, "error creating pipe")
+	}
+	orig, restore, err := redirectFile(std, w)
+	if err != nil {
+		r.Close()
+		w.Close()
+		return errors.Wrap(err, "error redirecting "+name)
+	}
+
+	pipe, _ := w.Stat()
+	c := &capture{
+		name:    name,
+		std:     std,
+		orig:    orig,
+		r:       r,
+		w:       w,
+		fd:      (*std).Fd(),
+		pipe:    pipe,
+		restore: restore,
+		done:    make(chan struct{}),
+	}
+	l.captures = append(l.captures, c)
+
+	// print logs to original stdout, else they would be captured
+	if name == "stdout" {
+		l.stdout.Store(orig)
+	}
+
+	lines := make(chan string, 64)
+	go l.readCapture(c, lines)
+	go l.groupCapture(c, lines)
+	return nil
+}
+
+// stopCaptures restores captured outputs, and waits for captured output to
+// be published or context to be done.
+func (l *Logger) stopCaptures(ctx context.Context) error {
+	l.captureMu.Lock()
+	captures := l.captures
+	l.captures = nil
+	l.captureMu.Unlock()
+
+	var firstErr error
+	for _, c := range captures {
+		c.restore()
+		c.w.Close()
+
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			if firstErr == nil {
+				firstErr = errors.Wrap(ctx.Err(), c.name+" capture did not stop")
+			}
+		}
+
+		if c.name == "stdout" {
+			l.stdout.Store(*c.std)
+		}
+		c.r.Close()
+		if c.orig != *c.std {
+			c.orig.Close()
+		}
+	}
+	return firstErr
+}
+
+// readCapture tees captured output to original output, and passes it on as
+// lines, till pipe is closed.
+func (l *Logger) readCapture(c *capture, lines chan<- string) {
+	defer close(lines)
+
+	reader := bufio.NewReader(c.r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			c.orig.WriteString(line)
+			lines <- strings.TrimRight(line, "\r\n")
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			l.internalError(&InternalError{Stage: StageRedirect, Err: err})
+			return
+		}
+	}
+}
+
+// groupCapture publishes captured lines as raw logs, grouping lines of a
+// goroutine dump into one log.
+func (l *Logger) groupCapture(c *capture, lines <-chan string) {
+	defer close(c.done)
+
+	var dump []string
+	var idle <-chan time.Time
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				l.pushCaptured(dump...)
+				return
+			}
+			if len(dump) > 0 && dumpLine(line) {
+				dump = append(dump, line)
+				idle = time.After(dumpIdle)
+				continue
 			}
-			mux(&log.Log{
-				Timestamp: time.Now().UTC().UnixNano() / 1e6,
-				Raw:       strings.TrimSpace(line),
-			})
+			l.pushCaptured(dump...)
+			dump = nil
+			idle = nil
+			if dumpStart(line) {
+				dump = []string{line}
+				idle = time.After(dumpIdle)
+				continue
+			}
+			l.pushCaptured(line)
+		case <-idle:
+			l.pushCaptured(dump...)
+			dump = nil
+			idle = nil
+		}
+	}
+}
+
+// pushCaptured publishes lines as a raw log. Captured output is already
+// printed, so it is not published to stdout sink, and not to sinks writing
+// to a captured output, where it would be captured again.
+func (l *Logger) pushCaptured(lines ...string) {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return
+	}
+	now := time.Now()
+	l.muxExcept(&log.Log{
+		Timestamp: now.UTC().UnixNano() / 1e6,
+		Level:     log.Level_none,
+		Raw:       strings.Join(lines, "\n"),
+	}, now, nil, l.capturedSink)
+}
+
+// capturedSink checks if sink prints to stdout, or to a captured output.
+// Filtered sinks are checked by the sink they wrap.
+func (l *Logger) capturedSink(sink Sink) bool {
+	for {
+		f, ok := sink.(*filterSink)
+		if !ok {
+			break
 		}
-	}()
+		sink = f.Sink
+	}
+	if _, ok := sink.(*stdoutSink); ok {
+		return true
+	}
+	fs, ok := sink.(fileSink)
+	if !ok {
+		return false
+	}
+	file := fs.outputFile()
+	if file == nil {
+		return false
+	}
+	info, _ := file.Stat()
+
+	l.captureMu.Lock()
+	defer l.captureMu.Unlock()
+	for _, c := range l.captures {
+		if file.Fd() == c.fd {
+			return true
+		}
+		if info != nil && c.pipe != nil && os.SameFile(info, c.pipe) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileSink is implemented by sinks printing to a file, to find sinks
+// printing to a captured output.
+type fileSink interface {
+	outputFile() *os.File
+}
+
+// dumpStart checks if line starts a goroutine dump.
+func dumpStart(line string) bool {
+	return strings.HasPrefix(line, "panic: ") ||
+		strings.HasPrefix(line, "fatal error: ") ||
+		(strings.HasPrefix(line, "goroutine ") && strings.HasSuffix(line, "]:"))
+}
+
+// dumpLine checks if line may be part of a goroutine dump, i.e. a blank
+// line, goroutine header, function call, or indented file and line.
+func dumpLine(line string) bool {
+	if line == "" || strings.HasPrefix(line, "\t") || dumpStart(line) {
+		return true
+	}
+	for _, prefix := range []string{"goroutine ", "created by ", "[", "...",
+		"runtime stack:", "signal "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(line, ")")
 }
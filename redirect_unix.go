@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package log
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectFile redirects output of file to w, at descriptor level so that
+// output written by runtime is redirected too. It returns a file writing to
+// original output, and a function restoring it.
+func redirectFile(std **os.File, w *os.File) (*os.File, func(), error) {
+	fd := int((*std).Fd())
+	saved, err := unix.Dup(fd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unix.Dup2(int(w.Fd()), fd); err != nil {
+		unix.Close(saved)
+		return nil, nil, err
+	}
+	orig := os.NewFile(uintptr(saved), (*std).Name())
+	restore := func() {
+		unix.Dup2(saved, fd)
+	}
+	return orig, restore, nil
+}
@@ -0,0 +1,17 @@
+package log
+
+import (
+	"os"
+)
+
+// redirectFile redirects output of file to w. Output written by runtime,
+// such as of a crash, is not redirected. It returns original file, and a
+// function restoring it.
+func redirectFile(std **os.File, w *os.File) (*os.File, func(), error) {
+	orig := *std
+	*std = w
+	restore := func() {
+		*std = orig
+	}
+	return orig, restore, nil
+}
@@ -0,0 +1,189 @@
+package log
+
+// Retry policy for sending logs to edge server.
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// default circuit breaker config.
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// Clock tells time, injected to test retry policy.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock is the real clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Backoff is exponential backoff with full jitter. Delay before a retry is
+// random, up to base * multiplier^retry, capped at max.
+type Backoff struct {
+	Base       time.Duration  // max delay of first retry
+	Multiplier float64        // growth of max delay per retry
+	Max        time.Duration  // cap of max delay
+	Rand       func() float64 // random number in [0, 1), math/rand if nil
+}
+
+// DefaultBackoff returns default backoff policy, from 1s up to 1m.
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Base:       time.Second,
+		Multiplier: 2,
+		Max:        time.Minute,
+	}
+}
+
+// Delay returns delay before given retry, counted from 0.
+func (b Backoff) Delay(retry int) time.Duration {
+	limit := float64(b.Base) * math.Pow(b.Multiplier, float64(retry))
+	if limit > float64(b.Max) || math.IsInf(limit, 0) || math.IsNaN(limit) {
+		limit = float64(b.Max)
+	}
+	random := rand.Float64
+	if b.Rand != nil {
+		random = b.Rand
+	}
+	return time.Duration(random() * limit)
+}
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed allows all attempts.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen allows no attempts, till cooldown is over.
+	BreakerOpen
+	// BreakerHalfOpen allows a single probe attempt.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Breaker is a circuit breaker. It opens after threshold consecutive
+// failures, stopping attempts for cooldown, and then allows a probe. A
+// successful probe closes it, a failed one opens it again.
+type Breaker struct {
+	Threshold int           // consecutive failures to open, 0 to never open
+	Cooldown  time.Duration // time open before a probe
+	Clock     Clock         // system clock if nil
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// NewBreaker creates a closed circuit breaker.
+func NewBreaker(threshold int, cooldown time.Duration, clock Clock) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, Clock: clock}
+}
+
+func (b *Breaker) now() time.Time {
+	if b.Clock == nil {
+		return time.Now()
+	}
+	return b.Clock.Now()
+}
+
+// Allow checks if an attempt may be made.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// probe in flight
+		return false
+	}
+	return true
+}
+
+// Success records a successful attempt, closing the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+}
+
+// Failure records a failed attempt, opening the breaker at threshold or
+// if probe failed.
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == BreakerHalfOpen ||
+		(b.Threshold > 0 && b.failures >= b.Threshold) {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// State returns current state of the breaker.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// SetBackoff sets backoff policy of default logger.
+func SetBackoff(backoff Backoff) {
+	std.SetBackoff(backoff)
+}
+
+// SetBackoff sets backoff policy for retries of sending logs to edge.
+func (l *Logger) SetBackoff(backoff Backoff) {
+	l.conf.backoff = backoff
+}
+
+// SetBreaker sets circuit breaker of default logger.
+func SetBreaker(threshold int, cooldown time.Duration) {
+	std.SetBreaker(threshold, cooldown)
+}
+
+// SetBreaker sets circuit breaker for sending logs to edge. It opens after
+// threshold consecutive failures, and probes edge after cooldown. It must
+// be set before API key.
+func (l *Logger) SetBreaker(threshold int, cooldown time.Duration) {
+	l.conf.breakerThreshold = threshold
+	l.conf.breakerCooldown = cooldown
+}
+
+// SetClock sets clock of default logger.
+func SetClock(clock Clock) {
+	std.SetClock(clock)
+}
+
+// SetClock sets clock used to time retries, for testing. It must be set
+// before API key.
+func (l *Logger) SetClock(clock Clock) {
+	l.conf.clock = clock
+}
@@ -0,0 +1,114 @@
+package log
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock moved by tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{
+		Base:       time.Second,
+		Multiplier: 2,
+		Max:        time.Minute,
+	}
+	tests := []struct {
+		retry int
+		rand  float64
+		want  time.Duration
+	}{
+		{0, 0, 0},
+		{0, 0.5, 500 * time.Millisecond},
+		{0, 0.75, 750 * time.Millisecond},
+		{1, 0.5, time.Second},
+		{3, 0.5, 4 * time.Second},
+		{5, 0.75, 24 * time.Second},
+		{6, 0.5, 30 * time.Second}, // capped at max
+		{100, 0.5, 30 * time.Second},
+		{10000, 0.5, 30 * time.Second}, // overflows to infinity
+	}
+	for _, test := range tests {
+		backoff.Rand = func() float64 { return test.rand }
+		if got := backoff.Delay(test.retry); got != test.want {
+			t.Errorf("Delay(%d) at %v: got %v, want %v",
+				test.retry, test.rand, got, test.want)
+		}
+	}
+}
+
+func TestBackoffDelayBounds(t *testing.T) {
+	backoff := DefaultBackoff()
+	for retry := 0; retry < 20; retry++ {
+		limit := backoff.Base << uint(retry)
+		if limit > backoff.Max || limit <= 0 {
+			limit = backoff.Max
+		}
+		for i := 0; i < 100; i++ {
+			if d := backoff.Delay(retry); d < 0 || d >= limit {
+				t.Fatalf("Delay(%d): %v out of [0, %v)", retry, d, limit)
+			}
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	b := NewBreaker(3, 10*time.Second, clock)
+
+	// steps run in order on the same breaker
+	steps := []struct {
+		name    string
+		do      func()
+		advance time.Duration
+		allow   bool
+		state   BreakerState
+	}{
+		{"starts closed", nil, 0, true, BreakerClosed},
+		{"failure below threshold", b.Failure, 0, true, BreakerClosed},
+		{"success resets failures", b.Success, 0, true, BreakerClosed},
+		{"failure 1", b.Failure, 0, true, BreakerClosed},
+		{"failure 2", b.Failure, 0, true, BreakerClosed},
+		{"failure 3 opens", b.Failure, 0, false, BreakerOpen},
+		{"open during cooldown", nil, 9 * time.Second, false, BreakerOpen},
+		{"half-open after cooldown", nil, time.Second, true, BreakerHalfOpen},
+		{"half-open allows one probe", nil, 0, false, BreakerHalfOpen},
+		{"failed probe opens", b.Failure, 0, false, BreakerOpen},
+		{"half-open after cooldown again", nil, 10 * time.Second, true, BreakerHalfOpen},
+		{"successful probe closes", b.Success, 0, true, BreakerClosed},
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			step.do()
+		}
+		clock.now = clock.now.Add(step.advance)
+		if got := b.Allow(); got != step.allow {
+			t.Fatalf("%s: Allow() = %v, want %v", step.name, got, step.allow)
+		}
+		if got := b.State(); got != step.state {
+			t.Fatalf("%s: State() = %v, want %v", step.name, got, step.state)
+		}
+	}
+}
+
+func TestBreakerNeverOpens(t *testing.T) {
+	b := NewBreaker(0, time.Second, &fakeClock{})
+	for i := 0; i < 100; i++ {
+		b.Failure()
+	}
+	if !b.Allow() || b.State() != BreakerClosed {
+		t.Fatalf("breaker with no threshold: %v", b.State())
+	}
+}
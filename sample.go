@@ -0,0 +1,159 @@
+package log
+
+// Sample and rate limit logs per call site.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// SuppressedKey is the tag reporting logs suppressed at the call site since
+// the previous published log.
+const SuppressedKey = "suppressed"
+
+// site identifies a call site.
+type site struct {
+	file string
+	line int
+}
+
+// siteCount counts logs at a call site in current interval.
+type siteCount struct {
+	start      time.Time
+	n          int
+	suppressed int64
+}
+
+// sampler samples logs per call site, and limits rate of all logs with a
+// token bucket.
+type sampler struct {
+	mu         sync.Mutex
+	first      int
+	thereafter int
+	interval   time.Duration
+	rate       float64 // tokens per second, 0 for no limit
+	burst      float64
+	tokens     float64
+	last       time.Time
+	sites      map[site]*siteCount
+}
+
+// SetSampling samples logs of default logger per call site.
+func SetSampling(first, thereafter int, interval time.Duration) {
+	std.SetSampling(first, thereafter, interval)
+}
+
+// SetSampling samples logs per call site. In each interval, first logs at
+// a call site are published, and then every thereafter-th log. Thereafter
+// of 0 suppresses all logs after first. First of 0 turns sampling off.
+// Fatal logs are never suppressed.
+func (l *Logger) SetSampling(first, thereafter int, interval time.Duration) {
+	l.samplerMu.Lock()
+	defer l.samplerMu.Unlock()
+	l.conf.sampleFirst = first
+	l.conf.sampleThereafter = thereafter
+	l.conf.sampleInterval = interval
+	l.resetSampler()
+}
+
+// SetRateLimit limits rate of logs of default logger.
+func SetRateLimit(rate float64, burst int) {
+	std.SetRateLimit(rate, burst)
+}
+
+// SetRateLimit limits logs published via this logger to rate per second,
+// with bursts of up to burst logs. Rate of 0 turns rate limit off. Fatal
+// logs are never suppressed.
+func (l *Logger) SetRateLimit(rate float64, burst int) {
+	l.samplerMu.Lock()
+	defer l.samplerMu.Unlock()
+	l.conf.rateLimit = rate
+	l.conf.rateBurst = burst
+	l.resetSampler()
+}
+
+// resetSampler creates sampler as per config, dropping current counts.
+func (l *Logger) resetSampler() {
+	if l.conf.sampleFirst <= 0 && l.conf.rateLimit <= 0 {
+		l.sampler.Store((*sampler)(nil))
+		return
+	}
+	burst := float64(l.conf.rateBurst)
+	if burst < 1 {
+		burst = 1
+	}
+	l.sampler.Store(&sampler{
+		first:      l.conf.sampleFirst,
+		thereafter: l.conf.sampleThereafter,
+		interval:   l.conf.sampleInterval,
+		rate:       l.conf.rateLimit,
+		burst:      burst,
+		tokens:     burst,
+		last:       time.Now(),
+		sites:      make(map[site]*siteCount),
+	})
+}
+
+// sample checks if log at call site is to be published. If so, it returns
+// count of logs suppressed at the call site since previous published log.
+func (l *Logger) sample(file string, line int, level log.Level) (int64, bool) {
+	s, _ := l.sampler.Load().(*sampler)
+	if s == nil {
+		return 0, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	key := site{file, line}
+	c, ok := s.sites[key]
+	if !ok {
+		c = &siteCount{start: now}
+		s.sites[key] = c
+	}
+
+	if !s.admit(c, now) && level != log.Level_fatal {
+		c.suppressed++
+		return 0, false
+	}
+
+	suppressed := c.suppressed
+	c.suppressed = 0
+	return suppressed, true
+}
+
+// admit counts log at call site, and checks sampling and rate limit.
+func (s *sampler) admit(c *siteCount, now time.Time) bool {
+
+	// sample call site
+	if s.first > 0 {
+		if s.interval > 0 && now.Sub(c.start) >= s.interval {
+			c.start = now
+			c.n = 0
+		}
+		c.n++
+		if c.n > s.first {
+			if s.thereafter <= 0 || (c.n-s.first)%s.thereafter != 0 {
+				return false
+			}
+		}
+	}
+
+	// take a token from bucket
+	if s.rate > 0 {
+		s.tokens += now.Sub(s.last).Seconds() * s.rate
+		s.last = now
+		if s.tokens > s.burst {
+			s.tokens = s.burst
+		}
+		if s.tokens < 1 {
+			return false
+		}
+		s.tokens--
+	}
+
+	return true
+}
@@ -0,0 +1,205 @@
+package log
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// Sink is a destination for logs published via a logger, such as stdout,
+// edge server, or a user defined destination.
+type Sink interface {
+	// Write publishes a log.
+	Write(lg *log.Log) error
+	// Flush publishes logs written so far.
+	Flush() error
+	// Close releases resources held by sink.
+	Close() error
+}
+
+// EntrySink is a sink taking log entries, with tags in order and global
+// tags. Sinks not implementing it are written logs, with tags of the line
+// only.
+type EntrySink interface {
+	Sink
+	// WriteEntry publishes a log entry. Entry must not be modified, as it
+	// is shared by sinks, and may be retained.
+	WriteEntry(e *Entry) error
+}
+
+// writeEntry writes entry to sink, as entry if sink takes entries, else as
+// log.
+func writeEntry(sink Sink, e *Entry) error {
+	if es, ok := sink.(EntrySink); ok {
+		return es.WriteEntry(e)
+	}
+	return sink.Write(e.Log)
+}
+
+// AddSink adds a sink to default logger.
+func AddSink(sink Sink) {
+	std.AddSink(sink)
+}
+
+// AddSink adds a sink, to publish all logs sent via this logger.
+func (l *Logger) AddSink(sink Sink) {
+	l.sinksMu.Lock()
+	defer l.sinksMu.Unlock()
+	l.sinks = append(l.sinks, sink)
+}
+
+// RemoveSink removes a sink from default logger.
+func RemoveSink(sink Sink) {
+	std.RemoveSink(sink)
+}
+
+// RemoveSink removes a sink, previously added to this logger. Removed sink
+// is neither flushed nor closed.
+func (l *Logger) RemoveSink(sink Sink) {
+	l.sinksMu.Lock()
+	defer l.sinksMu.Unlock()
+	var sinks []Sink
+	for _, s := range l.sinks {
+		if s != sink {
+			sinks = append(sinks, s)
+		}
+	}
+	l.sinks = sinks
+}
+
+// getSinks returns current sinks.
+func (l *Logger) getSinks() []Sink {
+	l.sinksMu.RLock()
+	defer l.sinksMu.RUnlock()
+	return l.sinks
+}
+
+// Stdout returns sink printing logs of default logger to stdout.
+func Stdout() Sink {
+	return std.Stdout()
+}
+
+// Stdout returns sink printing logs to stdout. It is added by default,
+// and may be removed, or replaced by a filtered sink.
+func (l *Logger) Stdout() Sink {
+	return l.stdoutSink
+}
+
+// NewStdoutSink returns sink printing logs of default logger to stdout via
+// formatter.
+func NewStdoutSink(f Formatter) Sink {
+	return std.NewStdoutSink(f)
+}
+
+// NewStdoutSink returns sink printing logs to stdout via formatter, rather
+// than via formatter of logger, such as to replace Stdout with a sink in
+// another format. Logs are printed when Stdout prints them.
+//
+//	log.RemoveSink(log.Stdout())
+//	log.AddSink(log.NewStdoutSink(&log.JSONEncoder{Keys: log.DefaultJSONKeys()}))
+func (l *Logger) NewStdoutSink(f Formatter) Sink {
+	return &stdoutSink{l: l, f: f}
+}
+
+// Edge returns sink sending logs of default logger to edge server.
+func Edge() Sink {
+	return std.Edge()
+}
+
+// Edge returns sink sending logs to edge server, once API key is set. It is
+// added by default, and may be removed, or replaced by a filtered sink.
+func (l *Logger) Edge() Sink {
+	return l.edgeSink
+}
+
+// filterSink publishes logs at or above level, and at or below verbosity.
+type filterSink struct {
+	Sink
+	level     log.Level
+	verbosity int32
+}
+
+// Filter wraps sink, to publish logs at or above given level, and at or
+// below given verbosity. Raw logs are always published. Filters apply in
+// addition to level and verbosity of the logger. It fails if level is not
+// known.
+//   warnings, err := log.Filter(log.Stdout(), log.LevelWarn, 0)
+//   log.RemoveSink(log.Stdout())
+//   log.AddSink(warnings)
+func Filter(sink Sink, level string, verbosity int32) (Sink, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return &filterSink{
+		Sink:      sink,
+		level:     lvl,
+		verbosity: verbosity,
+	}, nil
+}
+
+// Write publishes log if it passes the filter.
+func (s *filterSink) Write(lg *log.Log) error {
+	return s.WriteEntry(NewEntry(lg))
+}
+
+// WriteEntry publishes log entry if it passes the filter.
+func (s *filterSink) WriteEntry(e *Entry) error {
+	lg := e.Log
+	if lg.GetLevel() == log.Level_none {
+		return writeEntry(s.Sink, e)
+	}
+	if lg.GetLevel() < s.level || lg.GetVerbosity() > s.verbosity {
+		return nil
+	}
+	return writeEntry(s.Sink, e)
+}
+
+// writerSink prints logs to a writer via a formatter.
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  Formatter
+}
+
+// NewWriterSink returns sink printing logs to writer, one per line, via
+// formatter. Writer is not closed on Close.
+//
+//	log.AddSink(log.NewWriterSink(os.Stderr, &log.JSONEncoder{Keys: log.DefaultJSONKeys()}))
+func NewWriterSink(w io.Writer, f Formatter) Sink {
+	return &writerSink{w: w, f: f}
+}
+
+// Write prints log to writer.
+func (s *writerSink) Write(lg *log.Log) error {
+	return s.WriteEntry(NewEntry(lg))
+}
+
+// WriteEntry prints log entry to writer.
+func (s *writerSink) WriteEntry(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(append(formatEntry(s.f, e, nil), '\n'))
+	return err
+}
+
+// outputFile returns writer, if it is a file.
+func (s *writerSink) outputFile() *os.File {
+	f, _ := s.w.(*os.File)
+	return f
+}
+
+// Flush syncs writer, if it is a file.
+func (s *writerSink) Flush() error {
+	if f, ok := s.w.(*os.File); ok {
+		f.Sync()
+	}
+	return nil
+}
+
+// Close is a no-op, writer is left open.
+func (s *writerSink) Close() error {
+	return nil
+}
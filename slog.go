@@ -0,0 +1,158 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+// Adapt logger to log/slog.
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// slogHandler is a slog.Handler publishing records via a logger.
+type slogHandler struct {
+	l      *Logger
+	fields []Field // attributes added via WithAttrs
+	prefix string  // key prefix of open groups, such as "a.b."
+}
+
+// Handler returns slog handler publishing via default logger.
+func Handler() slog.Handler {
+	return std.Handler()
+}
+
+// Handler returns slog handler publishing records via this logger, as if
+// logged via logger itself. Levels below info are published as debug, and
+// levels above error as error. Attributes are published as tags, keys
+// prefixed with their groups, such as "req.id". Tags carried by context
+// via NewContext are published too.
+//
+//	logger := slog.New(log.Handler())
+func (l *Logger) Handler() slog.Handler {
+	return &slogHandler{l: l}
+}
+
+// slogLevel maps slog level onto log level.
+func slogLevel(level slog.Level) log.Level {
+	switch {
+	case level < slog.LevelInfo:
+		return log.Level_debug
+	case level < slog.LevelWarn:
+		return log.Level_info
+	case level < slog.LevelError:
+		return log.Level_warn
+	}
+	return log.Level_error
+}
+
+// Enabled checks if records at level are published.
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return slogLevel(level) >= h.l.conf.logLevel
+}
+
+// Handle publishes record.
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	level := slogLevel(r.Level)
+	if level < h.l.conf.logLevel {
+		return nil
+	}
+
+	// get location info from record
+	var file, function string
+	var line int
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		file = shortFile(frame.File)
+		function = shortFunction(frame.Function)
+		line = frame.Line
+	}
+
+	ts := r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	// tags from context first, then handler and record attributes
+	var fields []Field
+	if vtags, ok := ctx.Value(contextKey{}).(*VTags); ok {
+		fields = append(fields, vtags.fields...)
+	}
+	fields = append(fields, h.fields...)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+
+	h.l.publish(&log.Log{
+		File:      file,
+		Line:      int32(line),
+		Function:  function,
+		Timestamp: ts.UTC().UnixNano() / 1e6,
+		Level:     level,
+		Msg:       r.Message,
+	}, ts, fields)
+	return nil
+}
+
+// WithAttrs returns handler publishing given attributes with each record.
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := make([]Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(fields, h.fields)
+	for _, a := range attrs {
+		fields = appendAttr(fields, h.prefix, a)
+	}
+	return &slogHandler{l: h.l, fields: fields, prefix: h.prefix}
+}
+
+// WithGroup returns handler prefixing keys of attributes added later with
+// group name.
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{l: h.l, fields: h.fields, prefix: h.prefix + name + "."}
+}
+
+// appendAttr appends attribute as fields, flattening groups.
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	key := prefix + a.Key
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		// group without key is inlined
+		if a.Key != "" {
+			prefix = key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	case slog.KindString:
+		return append(fields, Str(key, a.Value.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(key, a.Value.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(key, a.Value.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float(key, a.Value.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(key, a.Value.Bool()))
+	case slog.KindDuration:
+		return append(fields, Dur(key, a.Value.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(key, a.Value.Time()))
+	}
+	return append(fields, Any(key, a.Value.Any()))
+}
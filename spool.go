@@ -0,0 +1,404 @@
+package log
+
+// Spool logs to disk while edge server is unreachable.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blitzlog/errors"
+	"github.com/blitzlog/proto/log"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	spoolSuffix      = ".spool"  // suffix of segment files
+	spoolCursor      = "cursor"  // file recording read position
+	spoolHeaderSize  = 8         // record length and checksum
+	spoolSegmentSize = 4 << 20   // max bytes per segment
+	spoolDrainLimit  = 16        // max spooled batches sent per flush
+	spoolMaxRecord   = 256 << 20 // max bytes per record, larger is corrupt
+)
+
+// StageSpool is the stage of spooling logs to disk.
+const StageSpool = "spool"
+
+// spool is a segmented append only file of log batches. Each record is the
+// length and checksum of an encoded log.Logs batch, followed by the batch.
+// Batches are read in order, and read position is recorded in cursor file,
+// so reading resumes after restart.
+type spool struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	segs     []int64 // segment sequence numbers, oldest first
+	size     int64   // bytes in all segments
+	w        *os.File
+	wSize    int64
+	rOff     int64 // read offset in oldest segment
+	rNext    int64 // offset after batch returned by peek
+}
+
+// SetSpool spools logs of default logger to disk.
+func SetSpool(dir string, maxBytes int64) error {
+	return std.SetSpool(dir, maxBytes)
+}
+
+// SetSpool spools logs to directory while edge server is unreachable, up
+// to max bytes, dropping oldest logs beyond. Spooled logs are sent in order
+// once connection is back, including logs spooled before a restart. Empty
+// dir turns spooling off, leaving spooled logs on disk.
+func (l *Logger) SetSpool(dir string, maxBytes int64) error {
+	var sp *spool
+	if dir != "" {
+		var err error
+		sp, err = openSpool(dir, maxBytes)
+		if err != nil {
+			return err
+		}
+	}
+
+	old, _ := l.spool.Load().(*spool)
+	l.spool.Store(sp)
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+// getSpool returns current spool, nil if not set.
+func (l *Logger) getSpool() *spool {
+	sp, _ := l.spool.Load().(*spool)
+	return sp
+}
+
+// spoolLogs writes logs to spool, returning logs that could not be spooled.
+// Spooled logs are done, as far as flush is concerned.
+func (l *Logger) spoolLogs(sp *spool, lgs []*log.Log) []*log.Log {
+	if sp == nil || len(lgs) == 0 {
+		return lgs
+	}
+	if err := sp.write(encodeBatch(lgs)); err != nil {
+		l.internalError(&InternalError{Stage: StageSpool, Err: err})
+		return lgs
+	}
+	l.pending.done(int64(len(lgs)))
+	return nil
+}
+
+// openSpool opens spool directory, creating it if needed.
+func openSpool(dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "error creating spool directory")
+	}
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"+spoolSuffix))
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing spool")
+	}
+
+	sp := &spool{dir: dir, maxBytes: maxBytes}
+	for _, name := range names {
+		seq, err := strconv.ParseInt(
+			strings.TrimSuffix(filepath.Base(name), spoolSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		sp.segs = append(sp.segs, seq)
+		sp.size += info.Size()
+	}
+	sort.Slice(sp.segs, func(i, j int) bool { return sp.segs[i] < sp.segs[j] })
+
+	sp.readCursor()
+	return sp, nil
+}
+
+// segPath returns path of segment.
+func (sp *spool) segPath(seq int64) string {
+	return filepath.Join(sp.dir, fmt.Sprintf("%020d%s", seq, spoolSuffix))
+}
+
+// empty checks if there are no batches to read.
+func (sp *spool) empty() bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	return sp.emptyLocked()
+}
+
+func (sp *spool) emptyLocked() bool {
+	if len(sp.segs) == 0 {
+		return true
+	}
+	if len(sp.segs) > 1 {
+		return false
+	}
+	info, err := os.Stat(sp.segPath(sp.segs[0]))
+	return err != nil || sp.rOff >= info.Size()
+}
+
+// write appends batch to newest segment.
+func (sp *spool) write(logs *log.Logs) error {
+	b, err := proto.Marshal(logs)
+	if err != nil {
+		return errors.Wrap(err, "error encoding logs")
+	}
+
+	rec := make([]byte, spoolHeaderSize+len(b))
+	binary.BigEndian.PutUint32(rec[0:], uint32(len(b)))
+	binary.BigEndian.PutUint32(rec[4:], crc32.ChecksumIEEE(b))
+	copy(rec[spoolHeaderSize:], b)
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.maxBytes > 0 && int64(len(rec)) > sp.maxBytes {
+		return errors.New("batch of %d bytes over spool size", len(rec))
+	}
+
+	// start new segment if none open, or record does not fit in current,
+	// so segments are never over max bytes and oldest may be dropped
+	segSize := int64(spoolSegmentSize)
+	if sp.maxBytes > 0 && sp.maxBytes < segSize {
+		segSize = sp.maxBytes
+	}
+	if sp.w == nil || (sp.wSize > 0 && sp.wSize+int64(len(rec)) > segSize) {
+		if err := sp.nextSegment(); err != nil {
+			return err
+		}
+	}
+
+	n, err := sp.w.Write(rec)
+	sp.wSize += int64(n)
+	sp.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "error writing spool")
+	}
+
+	sp.trim()
+	return nil
+}
+
+// nextSegment closes current segment and creates a new one.
+func (sp *spool) nextSegment() error {
+	if sp.w != nil {
+		sp.w.Close()
+		sp.w = nil
+	}
+	var seq int64
+	if len(sp.segs) > 0 {
+		seq = sp.segs[len(sp.segs)-1] + 1
+	}
+	f, err := os.OpenFile(sp.segPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "error creating spool segment")
+	}
+	sp.segs = append(sp.segs, seq)
+	sp.w = f
+	sp.wSize = 0
+	return nil
+}
+
+// trim drops oldest segments while spool is over max bytes, keeping the
+// segment being written, which is never over max bytes by itself.
+func (sp *spool) trim() {
+	for sp.maxBytes > 0 && sp.size > sp.maxBytes && len(sp.segs) > 1 {
+		sp.dropOldest()
+	}
+}
+
+// dropOldest removes oldest segment, and resets read position.
+func (sp *spool) dropOldest() {
+	if len(sp.segs) == 1 && sp.w != nil {
+		sp.w.Close()
+		sp.w = nil
+	}
+	path := sp.segPath(sp.segs[0])
+	if info, err := os.Stat(path); err == nil {
+		sp.size -= info.Size()
+	}
+	os.Remove(path)
+	sp.segs = sp.segs[1:]
+	sp.rOff = 0
+	sp.rNext = 0
+	sp.writeCursor()
+}
+
+// peek returns oldest batch, or nil if spool is empty. Batch is removed
+// from spool by pop. Corrupt records, such as a partial write before a
+// crash, are skipped along with rest of their segment.
+func (sp *spool) peek() (*log.Logs, error) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	for !sp.emptyLocked() {
+		logs, next, err := sp.readRecord(sp.segs[0], sp.rOff)
+		if err == io.EOF {
+			// oldest segment is done, if it is not being written
+			if len(sp.segs) == 1 {
+				return nil, nil
+			}
+			sp.dropOldest()
+			continue
+		}
+		if err != nil {
+			sp.dropOldest()
+			return nil, errors.Wrap(err, "corrupt spool segment")
+		}
+		sp.rNext = next
+		return logs, nil
+	}
+	return nil, nil
+}
+
+// pop removes batch returned by peek.
+func (sp *spool) pop() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.rNext > sp.rOff {
+		sp.rOff = sp.rNext
+		sp.writeCursor()
+	}
+}
+
+// readRecord reads record at offset of segment, returning offset of next
+// record.
+func (sp *spool) readRecord(seq, off int64) (*log.Logs, int64, error) {
+	f, err := os.Open(sp.segPath(seq))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	header := make([]byte, spoolHeaderSize)
+	n, err := f.ReadAt(header, off)
+	if n == 0 && err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error reading record header")
+	}
+
+	size := binary.BigEndian.Uint32(header[0:])
+	sum := binary.BigEndian.Uint32(header[4:])
+	if size > spoolMaxRecord {
+		return nil, 0, errors.New("record too large: %d", size)
+	}
+
+	b := make([]byte, size)
+	if _, err := f.ReadAt(b, off+spoolHeaderSize); err != nil {
+		return nil, 0, errors.Wrap(err, "error reading record")
+	}
+	if crc32.ChecksumIEEE(b) != sum {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+
+	logs := new(log.Logs)
+	if err := proto.Unmarshal(b, logs); err != nil {
+		return nil, 0, errors.Wrap(err, "error decoding record")
+	}
+	return logs, off + spoolHeaderSize + int64(size), nil
+}
+
+// readCursor restores read position of oldest segment.
+func (sp *spool) readCursor() {
+	b, err := ioutil.ReadFile(filepath.Join(sp.dir, spoolCursor))
+	if err != nil || len(sp.segs) == 0 {
+		return
+	}
+	var seq, off int64
+	if _, err := fmt.Sscanf(string(b), "%d %d", &seq, &off); err != nil {
+		return
+	}
+
+	// drop segments read before cursor
+	for len(sp.segs) > 0 && sp.segs[0] < seq {
+		sp.dropOldest()
+	}
+	if len(sp.segs) > 0 && sp.segs[0] == seq {
+		sp.rOff = off
+	}
+}
+
+// writeCursor records read position of oldest segment.
+func (sp *spool) writeCursor() {
+	var seq int64
+	if len(sp.segs) > 0 {
+		seq = sp.segs[0]
+	}
+	path := filepath.Join(sp.dir, spoolCursor)
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("%d %d\n", seq, sp.rOff)
+	if err := ioutil.WriteFile(tmp, []byte(data), 0644); err == nil {
+		os.Rename(tmp, path)
+	}
+}
+
+// close closes segment being written.
+func (sp *spool) close() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.w == nil {
+		return nil
+	}
+	err := sp.w.Close()
+	sp.w = nil
+	return err
+}
+
+// encodeBatch encodes logs as a self contained batch, with its own keys.
+func encodeBatch(lgs []*log.Log) *log.Logs {
+	tx := NewTx()
+	logs := new(log.Logs)
+	for _, lg := range lgs {
+		logs = tx.Append(logs, lg)
+	}
+	return logs
+}
+
+// decodeBatch decodes logs of a self contained batch. Batch keeps logs and
+// raw logs apart, so they are merged back by timestamp, in order otherwise.
+func decodeBatch(logs *log.Logs) []*log.Log {
+	lgs := make([]*log.Log, 0, len(logs.Vals)+len(logs.Raws))
+	vals, raws := logs.Vals, logs.Raws
+	for len(vals) > 0 || len(raws) > 0 {
+		if len(raws) > 0 && (len(vals) == 0 || raws[0].Timestamp < vals[0].Timestamp) {
+			lgs = append(lgs, &log.Log{
+				Timestamp: raws[0].Timestamp,
+				Raw:       raws[0].Raw,
+			})
+			raws = raws[1:]
+			continue
+		}
+
+		val := vals[0]
+		vals = vals[1:]
+		if int(val.Index) >= len(logs.Keys) {
+			continue
+		}
+		key := logs.Keys[val.Index]
+		lgs = append(lgs, &log.Log{
+			File:      key.File,
+			Line:      key.Line,
+			Function:  key.Function,
+			Level:     key.Level,
+			Verbosity: key.Verbosity,
+			Msg:       key.Msg,
+			Timestamp: val.Timestamp,
+			Tags:      val.LineTags,
+		})
+	}
+	return lgs
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"sort"
 	"sync"
 )
 
@@ -10,6 +11,7 @@ type tags struct {
 	reset bool
 	all   map[string]string
 	dirty map[string]string
+	local EntryTags // all tags sorted by key, for local output, nil if stale
 }
 
 // newTags initializes tags structure.
@@ -20,18 +22,40 @@ func newTags() *tags {
 	}
 }
 
-// Global sets global tags, for all logs sent via this instance.
+// Global sets global tags, for all logs sent via default logger.
 func Global(tags Tags) {
+	std.Global(tags)
+}
+
+// Global sets global tags, for all logs sent via this instance.
+func (l *Logger) Global(tags Tags) {
 	l.tags.mu.Lock()
 	defer l.tags.mu.Unlock()
 	for k, v := range tags {
 		l.tags.all[k] = String(v)
 		l.tags.dirty[k] = String(v)
 	}
+	l.tags.local = nil
+}
+
+// globalTags returns all global tags, sorted by key. Returned tags are
+// shared, and must not be modified.
+func (l *Logger) globalTags() EntryTags {
+	l.tags.mu.Lock()
+	defer l.tags.mu.Unlock()
+	if l.tags.local == nil && len(l.tags.all) > 0 {
+		local := make(EntryTags, 0, len(l.tags.all))
+		for k, v := range l.tags.all {
+			local = append(local, EntryTag{k, v})
+		}
+		sort.Slice(local, func(i, j int) bool { return local[i].Key < local[j].Key })
+		l.tags.local = local
+	}
+	return l.tags.local
 }
 
 // getGlobalTags returns new global tags.
-func getGlobalTags() map[string]string {
+func (l *Logger) getGlobalTags() map[string]string {
 
 	l.tags.mu.Lock()
 	defer l.tags.mu.Unlock()
@@ -57,7 +81,7 @@ func getGlobalTags() map[string]string {
 
 // resetGlobalTags forces re-sending all global tags,
 // used when log client connection breaks.
-func resetGlobalTags() {
+func (l *Logger) resetGlobalTags() {
 	l.tags.mu.Lock()
 	defer l.tags.mu.Unlock()
 	l.tags.reset = true
@@ -0,0 +1,143 @@
+package log
+
+// Per file and per function verbosity, glog style.
+
+import (
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blitzlog/errors"
+)
+
+// vrule sets verbosity for call sites matching a pattern.
+type vrule struct {
+	pattern   string
+	parts     int // path components matched by pattern
+	verbosity int32
+}
+
+// vmodule holds verbosity rules, and verbosity resolved per call site.
+type vmodule struct {
+	rules []vrule
+	sites sync.Map // pc -> int32
+}
+
+// SetVModule sets per file verbosity of default logger.
+func SetVModule(spec string) error {
+	return std.SetVModule(spec)
+}
+
+// SetVModule sets verbosity for matching call sites, as comma separated
+// pattern=verbosity rules. Pattern without slash matches file name without
+// .go, or function name. Pattern with slashes matches as many trailing
+// directories of file path. First matching rule applies, and logs pass if
+// they are verbose as either the rule or global verbosity. Empty spec
+// removes all rules.
+//
+//	log.SetVModule("edge*=3,db/*=2")
+func (l *Logger) SetVModule(spec string) error {
+	var rules []vrule
+	for _, rule := range strings.Split(spec, ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		eq := strings.LastIndex(rule, "=")
+		if eq <= 0 {
+			return errors.New("invalid vmodule rule: %q", rule)
+		}
+		pattern := rule[:eq]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New("invalid vmodule pattern: %q", pattern)
+		}
+		v, err := strconv.ParseInt(rule[eq+1:], 10, 32)
+		if err != nil {
+			return errors.New("invalid vmodule verbosity: %q", rule)
+		}
+		rules = append(rules, vrule{
+			pattern:   pattern,
+			parts:     strings.Count(pattern, "/") + 1,
+			verbosity: int32(v),
+		})
+	}
+
+	// replace rules, dropping cached call sites
+	if len(rules) == 0 {
+		l.vmodule.Store((*vmodule)(nil))
+		return nil
+	}
+	l.vmodule.Store(&vmodule{rules: rules})
+	return nil
+}
+
+// vmoduleVerbose checks if log at given verbosity passes vmodule rules for
+// call site depth frames above caller of log method. It must be called by
+// verbose or verboseDepth, from a log method.
+func (l *Logger) vmoduleVerbose(verbosity int32, depth int) bool {
+	vm, _ := l.vmodule.Load().(*vmodule)
+	if vm == nil {
+		return false
+	}
+
+	// skip Callers, vmoduleVerbose, verbose and log method
+	var pcs [1]uintptr
+	if runtime.Callers(4+depth, pcs[:]) == 0 {
+		return false
+	}
+
+	if v, ok := vm.sites.Load(pcs[0]); ok {
+		return verbosity <= v.(int32)
+	}
+
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	v := vm.match(frame.File, frame.Function)
+	vm.sites.Store(pcs[0], v)
+	return verbosity <= v
+}
+
+// match returns verbosity of first rule matching file or function, or -1 if
+// none match.
+func (vm *vmodule) match(file, function string) int32 {
+	file = strings.TrimSuffix(file, ".go")
+	base := path.Base(file)
+
+	// function name without package path and receiver
+	fn := function
+	if slash := strings.LastIndex(fn, "/"); slash >= 0 {
+		fn = fn[slash+1:]
+	}
+	if dot := strings.LastIndex(fn, "."); dot >= 0 {
+		fn = fn[dot+1:]
+	}
+
+	for _, rule := range vm.rules {
+		if rule.parts == 1 {
+			if ok, _ := path.Match(rule.pattern, base); ok {
+				return rule.verbosity
+			}
+			if ok, _ := path.Match(rule.pattern, fn); ok {
+				return rule.verbosity
+			}
+			continue
+		}
+		if ok, _ := path.Match(rule.pattern, lastParts(file, rule.parts)); ok {
+			return rule.verbosity
+		}
+	}
+	return -1
+}
+
+// lastParts returns last n slash separated components of path.
+func lastParts(file string, n int) string {
+	i := len(file)
+	for ; n > 0; n-- {
+		i = strings.LastIndex(file[:i], "/")
+		if i < 0 {
+			return file
+		}
+	}
+	return file[i+1:]
+}
@@ -0,0 +1,141 @@
+package log
+
+// Bridge io.Writer and standard library log to logger.
+
+import (
+	"bytes"
+	"io"
+	stdlog "log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/blitzlog/proto/log"
+)
+
+// maxWriterLine is the max bytes buffered for a line, longer lines are
+// published in parts.
+const maxWriterLine = 64 << 10
+
+// lineWriter publishes each line written to it as a log.
+type lineWriter struct {
+	l         *Logger
+	level     log.Level
+	fields    []Field
+	shortfile bool // lines are prefixed with file:line, as by stdlog
+	mu        sync.Mutex
+	buf       []byte // partial line
+}
+
+// Writer returns writer publishing lines via default logger.
+func Writer(level string, tags Tags) (io.Writer, error) {
+	return std.Writer(level, tags)
+}
+
+// Writer returns a writer publishing each line written to it as a log at
+// given level, with given tags. A partial line is buffered till the rest
+// of it is written. Logs have no file and line, as the writer does not
+// know who wrote them. It fails if level is unknown.
+//
+//	cmd.Stderr, err = log.Writer(log.LevelWarn, log.Tags{"cmd": "backup"})
+func (l *Logger) Writer(level string, tags Tags) (io.Writer, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return &lineWriter{
+		l:      l,
+		level:  lvl,
+		fields: tags.fields(),
+	}, nil
+}
+
+// StdLogger returns standard library logger publishing via default logger.
+func StdLogger(level string) (*stdlog.Logger, error) {
+	return std.StdLogger(level)
+}
+
+// StdLogger returns a standard library logger publishing each log at given
+// level via this logger, with file and line of the caller. It fails if level
+// is unknown.
+//
+//	errorLog, err := log.StdLogger(log.LevelError)
+//	srv := &http.Server{ErrorLog: errorLog}
+func (l *Logger) StdLogger(level string) (*stdlog.Logger, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	w := &lineWriter{
+		l:         l,
+		level:     lvl,
+		shortfile: true,
+	}
+	return stdlog.New(w, "", stdlog.Lshortfile), nil
+}
+
+// Write publishes complete lines, buffering a partial line.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) >= maxWriterLine {
+				w.publish(w.buf)
+				w.buf = w.buf[:0]
+			}
+			break
+		}
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, p[:i]...)
+			w.publish(w.buf)
+			w.buf = w.buf[:0]
+		} else {
+			w.publish(p[:i])
+		}
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// publish line as log.
+func (w *lineWriter) publish(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) == 0 || w.level < w.l.conf.logLevel {
+		return
+	}
+
+	// location of lines written is not known, unless prefixed
+	now := time.Now()
+	lg := &log.Log{
+		Timestamp: now.UTC().UnixNano() / 1e6,
+		Level:     w.level,
+	}
+	if w.shortfile {
+		lg.File, lg.Line, line = splitShortfile(line)
+	}
+	lg.Msg = string(line)
+	w.l.publish(lg, now, w.fields)
+}
+
+// splitShortfile splits "file.go:12: msg" prefix, as added by stdlog, into
+// file, line and message. File is empty if line has no such prefix.
+func splitShortfile(line []byte) (string, int32, []byte) {
+	end := bytes.Index(line, []byte(": "))
+	if end < 0 {
+		return "", 0, line
+	}
+	colon := bytes.LastIndexByte(line[:end], ':')
+	if colon < 0 {
+		return "", 0, line
+	}
+	n, err := strconv.ParseInt(string(line[colon+1:end]), 10, 32)
+	if err != nil {
+		return "", 0, line
+	}
+	return string(line[:colon]), int32(n), line[end+2:]
+}